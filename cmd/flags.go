@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"flag"
+	"strings"
+)
+
+// stringsFlag collects the values of a flag that may be repeated or given as
+// a comma-separated list.
+type stringsFlag struct {
+	values []string
+}
+
+func newStringsFlag(name, usage string) *stringsFlag {
+	f := &stringsFlag{}
+	flag.Var(f, name, usage)
+	return f
+}
+
+func (f *stringsFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	return strings.Join(f.values, ",")
+}
+
+func (f *stringsFlag) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			f.values = append(f.values, v)
+		}
+	}
+	return nil
+}
@@ -9,37 +9,93 @@ import (
 	"math/big"
 	"os"
 	"os/signal"
+	"reflect"
+	"sort"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/chainflag/eth-faucet/internal/chain"
+	"github.com/chainflag/eth-faucet/internal/config"
 	"github.com/chainflag/eth-faucet/internal/server"
 )
 
+const configPollInterval = 5 * time.Second
+
 var (
 	appVersion = "v1.2.1"
 	chainIDMap = map[string]int{"sepolia": 11155111, "holesky": 17000}
+	defaults   = config.Default()
 
-	httpPortFlag = flag.Int("httpport", 8080, "Listener port to serve HTTP connection")
-	proxyCntFlag = flag.Int("proxycount", 0, "Count of reverse proxies in front of the server")
+	configFlag   = flag.String("config", os.Getenv("FAUCET_CONFIG"), "YAML or TOML configuration file, overridden by environment variables and flags")
+	httpPortFlag = flag.Int("httpport", defaults.HTTPPort, "Listener port to serve HTTP connection")
+	proxyCntFlag = flag.Int("proxycount", defaults.ProxyCount, "Count of reverse proxies in front of the server")
 	versionFlag  = flag.Bool("version", false, "Print version number")
 
-	payoutFlag   = flag.Float64("faucet.amount", 1, "Number of Ethers to transfer per user request")
-	intervalFlag = flag.Int("faucet.minutes", 1440, "Number of minutes to wait between funding rounds")
-	netnameFlag  = flag.String("faucet.name", "testnet", "Network name to display on the frontend")
-	symbolFlag   = flag.String("faucet.symbol", "ETH", "Token symbol to display on the frontend")
+	payoutFlag   = flag.Float64("faucet.amount", defaults.Faucet.Amount, "Number of Ethers to transfer per user request")
+	intervalFlag = flag.Int("faucet.minutes", defaults.Faucet.Minutes, "Number of minutes to wait between funding rounds")
+	netnameFlag  = flag.String("faucet.name", defaults.Faucet.Name, "Network name to display on the frontend")
+	symbolFlag   = flag.String("faucet.symbol", defaults.Faucet.Symbol, "Token symbol to display on the frontend")
+	tokensFlag   = flag.String("faucet.tokens", "", "Comma-separated ERC-20 tokens to dispense, each as symbol:address:decimals:amount")
+	minFundsFlag = flag.Float64("faucet.minbalance", defaults.Faucet.MinBalance, "Faucet balance in Ethers below which new claims are refused, 0 to disable")
+	lowFundsFlag = flag.Float64("faucet.lowbalance", defaults.Faucet.LowBalance, "Faucet balance in Ethers below which the payout is reduced proportionally, 0 to disable")
+	hourlyFlag   = flag.Float64("faucet.hourlybudget", defaults.Faucet.HourlyBudget, "Ethers paid out per hour across all claims, 0 for no limit")
+	dailyFlag    = flag.Float64("faucet.dailybudget", defaults.Faucet.DailyBudget, "Ethers paid out per UTC day across all claims, 0 for no limit")
+
+	batchContractFlag = flag.String("batch.contract", defaults.Batch.Contract, "Disperse contract to pay out claims in batches through, empty to disable batching")
+	batchWindowFlag   = flag.Duration("batch.window", defaults.Batch.Window, "Time to wait for further claims to join a batch")
+	batchSizeFlag     = flag.Int("batch.size", defaults.Batch.Size, "Maximum number of claims paid out in one batch transaction")
+
+	limiterBackendFlag = flag.String("limiter.backend", defaults.Limiter.Backend, "Storage backend for rate limit records, one of memory, bolt or redis")
+	limiterPathFlag    = flag.String("limiter.path", defaults.Limiter.Path, "Database file to persist rate limit records in when using the bolt backend")
+	limiterRedisFlag   = flag.String("limiter.redis", defaults.Limiter.Redis, "Redis URL to share rate limit records through when using the redis backend")
+
+	historyPathFlag      = flag.String("history.path", defaults.History.Path, "Database file to record every claim attempt in, empty to disable the claim history")
+	historyRetentionFlag = flag.Duration("history.retention", defaults.History.Retention, "Time claim records are kept for, 0 to keep them forever")
+
+	keyJSONFlag  = flag.String("wallet.keyjson", defaults.Wallet.KeyJSON, "Keystore file, or directory of keystore files, to fund user requests with")
+	keyPassFlag  = flag.String("wallet.keypass", defaults.Wallet.KeyPass, "Passphrase text file to decrypt keystore")
+	privKeyFlag  = newStringsFlag("wallet.privkey", "Private key hex to fund user requests with, repeat or separate by commas for several accounts")
+	providerFlag = flag.String("wallet.provider", defaults.Wallet.Provider, "Endpoint for Ethereum JSON-RPC connection")
+	replaceFlag  = flag.Duration("wallet.replaceafter", defaults.Wallet.ReplaceAfter, "Pending time after which a transaction is rebroadcast with bumped fees, 0 to disable")
+	maxFeeFlag   = flag.Float64("wallet.maxfee", defaults.Wallet.MaxFee, "Ceiling in gwei for the fee cap of replacement transactions, 0 for no ceiling")
+
+	hcaptchaSiteKeyFlag = flag.String("hcaptcha.sitekey", defaults.HCaptcha.SiteKey, "hCaptcha sitekey")
+	hcaptchaSecretFlag  = flag.String("hcaptcha.secret", defaults.HCaptcha.Secret, "hCaptcha secret")
+
+	captchaProviderFlag  = flag.String("captcha.provider", defaults.Captcha.Provider, "Captcha provider, one of "+strings.Join(config.CaptchaProviders, ", "))
+	captchaSiteKeyFlag   = flag.String("captcha.sitekey", defaults.Captcha.SiteKey, "Captcha sitekey")
+	captchaSecretFlag    = flag.String("captcha.secret", defaults.Captcha.Secret, "Captcha secret")
+	captchaVerifyURLFlag = flag.String("captcha.verifyurl", defaults.Captcha.VerifyURL, "Verification endpoint overriding the one of the captcha provider")
+	captchaMinScoreFlag  = flag.Float64("captcha.minscore", defaults.Captcha.MinScore, "Lowest reCAPTCHA v3 score accepted")
+
+	powDifficultyFlag = flag.Int("pow.difficulty", defaults.PoW.Difficulty, "Leading zero bits required of proof-of-work solutions, 0 to disable")
+	powSecretFlag     = flag.String("pow.secret", defaults.PoW.Secret, "Secret signing proof-of-work challenges, shared by all instances, random if empty")
+	powTTLFlag        = flag.Duration("pow.ttl", defaults.PoW.TTL, "Time a proof-of-work challenge stays valid")
+
+	allowlistFlag = flag.String("access.allowlist", defaults.Access.Allowlist, "File of addresses, IPs and CIDR ranges exempt from the claim cooldown")
+	denylistFlag  = flag.String("access.denylist", defaults.Access.Denylist, "File of addresses, IPs and CIDR ranges refused from claiming")
 
-	keyJSONFlag  = flag.String("wallet.keyjson", os.Getenv("KEYSTORE"), "Keystore file to fund user requests with")
-	keyPassFlag  = flag.String("wallet.keypass", "password.txt", "Passphrase text file to decrypt keystore")
-	privKeyFlag  = flag.String("wallet.privkey", os.Getenv("PRIVATE_KEY"), "Private key hex to fund user requests with")
-	providerFlag = flag.String("wallet.provider", os.Getenv("WEB3_PROVIDER"), "Endpoint for Ethereum JSON-RPC connection")
+	maxBalanceFlag   = flag.Float64("eligibility.maxbalance", defaults.Eligibility.MaxBalance, "Recipient balance in Ethers above which claims are refused, 0 to disable")
+	minNonceFlag     = flag.Int("eligibility.minnonce", defaults.Eligibility.MinNonce, "Transactions a recipient must have sent on the faucet network")
+	activityRPCFlag  = flag.String("eligibility.activityrpc", defaults.Eligibility.ActivityRPC, "Endpoint of the network, such as mainnet, to check recipient activity on")
+	activityNameFlag = flag.String("eligibility.activityname", defaults.Eligibility.ActivityName, "Name of the activity network shown to users")
+	minActivityFlag  = flag.Int("eligibility.minactivity", defaults.Eligibility.MinActivity, "Transactions a recipient must have sent on the activity network")
 
-	hcaptchaSiteKeyFlag = flag.String("hcaptcha.sitekey", os.Getenv("HCAPTCHA_SITEKEY"), "hCaptcha sitekey")
-	hcaptchaSecretFlag  = flag.String("hcaptcha.secret", os.Getenv("HCAPTCHA_SECRET"), "hCaptcha secret")
+	authSecretFlag     = flag.String("auth.secret", defaults.Auth.Secret, "Secret signing sign-in sessions, shared by all instances, random if empty")
+	authKeyFileFlag    = flag.String("auth.keyfile", defaults.Auth.KeyFile, "JSON file holding the API keys issued through the admin API")
+	authAPIKeysFlag    = newStringsFlag("auth.apikeys", "Deprecated: hex SHA-256 hash of an accepted API key, use -auth.keyfile instead")
+	githubClientIDFlag = flag.String("auth.github.clientid", defaults.Auth.GitHub.ClientID, "Client ID of the GitHub OAuth app users sign in with")
+	githubSecretFlag   = flag.String("auth.github.clientsecret", defaults.Auth.GitHub.ClientSecret, "Client secret of the GitHub OAuth app")
+
+	adminTokenFlag    = flag.String("admin.token", defaults.Admin.Token, "Bearer token granting access to the admin API")
+	adminUserFlag     = flag.String("admin.user", defaults.Admin.User, "Basic auth user granting access to the admin API")
+	adminPasswordFlag = flag.String("admin.password", defaults.Admin.Password, "Basic auth password granting access to the admin API")
+	adminListenFlag   = flag.String("admin.listen", defaults.Admin.Listen, "Separate address to serve the admin API on, empty to serve it on the main port")
 )
 
 func init() {
@@ -51,25 +107,72 @@ func init() {
 }
 
 func Execute() {
-	privateKey, err := getPrivateKeyFromFlags()
+	cfg, err := loadConfig()
+	if err != nil {
+		panic(fmt.Errorf("failed to load configuration: %w", err))
+	}
+
+	privateKeys, err := getPrivateKeys(cfg.Wallet)
 	if err != nil {
 		panic(fmt.Errorf("failed to read private key: %w", err))
 	}
-	var chainID *big.Int
-	if value, ok := chainIDMap[strings.ToLower(*netnameFlag)]; ok {
-		chainID = big.NewInt(int64(value))
+	policy := chain.ReplacePolicy{After: cfg.Wallet.ReplaceAfter}
+	if cfg.Wallet.MaxFee > 0 {
+		policy.MaxFee = chain.ToBaseUnits(cfg.Wallet.MaxFee, 9)
+	}
+	// Left unset without an activity network, as a nil client in the interface
+	// would not compare equal to nil
+	var activity chain.AccountReader
+	if cfg.Eligibility.ActivityRPC != "" {
+		client, err := ethclient.Dial(cfg.Eligibility.ActivityRPC)
+		if err != nil {
+			panic(fmt.Errorf("cannot connect to activity provider: %w", err))
+		}
+		activity = client
+	}
+	// Stops tracking transactions and balances once the server has shut down
+	background, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	builders := make(map[string]chain.TxBuilder)
+	checkers := make(map[string]*chain.EligibilityChecker)
+	for _, network := range cfg.ResolvedNetworks() {
+		client, err := ethclient.Dial(network.Provider)
+		if err != nil {
+			panic(fmt.Errorf("cannot connect to web3 provider of %s: %w", network.Name, err))
+		}
+		txBuilder, err := chain.NewTxBuilder(background, client, privateKeys, networkChainID(network), policy)
+		if err != nil {
+			panic(fmt.Errorf("cannot connect to web3 provider of %s: %w", network.Name, err))
+		}
+		builders[network.Name] = txBuilder
+		checkers[network.Name] = chain.NewEligibilityChecker(client, activity)
 	}
 
-	txBuilder, err := chain.NewTxBuilder(*providerFlag, privateKey, chainID)
+	limitStore, err := getLimitStore(cfg.Limiter)
 	if err != nil {
-		panic(fmt.Errorf("cannot connect to web3 provider: %w", err))
+		panic(fmt.Errorf("failed to open rate limit store: %w", err))
 	}
+	defer limitStore.Close()
 
-	config := server.NewConfig(*netnameFlag, *symbolFlag, *httpPortFlag, *intervalFlag, *proxyCntFlag, *payoutFlag, *hcaptchaSiteKeyFlag, *hcaptchaSecretFlag)
-	srv := server.NewServer(txBuilder, config)
+	var history *server.ClaimHistory
+	if cfg.History.Path != "" {
+		if history, err = server.OpenClaimHistory(cfg.History.Path, cfg.History.Retention); err != nil {
+			panic(fmt.Errorf("failed to open claim history: %w", err))
+		}
+		defer history.Close()
+	}
+
+	srv := server.NewServer(builders, checkers, limitStore, history, server.NewConfig(cfg))
+	if err := srv.LoadAccessLists(); err != nil {
+		panic(fmt.Errorf("failed to load access lists: %w", err))
+	}
+	if err := srv.LoadAPIKeys(); err != nil {
+		panic(fmt.Errorf("failed to load API keys: %w", err))
+	}
 
 	// Run server in goroutine
 	go srv.Run()
+	go watchConfig(srv, cfg)
 
 	// Wait for interrupt signal
 	c := make(chan os.Signal, 1)
@@ -86,27 +189,288 @@ func Execute() {
 	} else {
 		log.Info("Server exited")
 	}
+	stopBackground()
+}
+
+// loadConfig layers the configuration file, environment variables and the
+// flags given on the command line over the defaults, in that order.
+func loadConfig() (*config.Config, error) {
+	cfg := config.Default()
+	if *configFlag != "" {
+		if err := cfg.Load(*configFlag); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.ApplyEnv(os.LookupEnv); err != nil {
+		return nil, err
+	}
+	if err := applyFlags(cfg); err != nil {
+		return nil, err
+	}
+	return cfg, cfg.Validate()
+}
+
+// watchConfig reloads the configuration on SIGHUP and whenever the
+// configuration file changes. Invalid configurations are rejected and the
+// current one is kept.
+func watchConfig(srv *server.Server, started *config.Config) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	ticker := time.NewTicker(configPollInterval)
+	defer ticker.Stop()
+
+	modTime := configModTime()
+	for {
+		select {
+		case <-hup:
+			log.Info("Received SIGHUP, reloading configuration")
+		case <-ticker.C:
+			t := configModTime()
+			if t.Equal(modTime) {
+				continue
+			}
+			modTime = t
+			log.Info("Configuration file changed, reloading configuration")
+		}
+
+		cfg, err := loadConfig()
+		if err != nil {
+			log.WithError(err).Error("Failed to reload configuration, keeping the current one")
+			continue
+		}
+		for _, key := range restartRequired(started, cfg) {
+			log.WithField("setting", key).Warn("Setting changed but only takes effect after a restart")
+		}
+		srv.Reload(server.NewConfig(cfg))
+	}
+}
+
+// networkChainID returns the chain ID configured for network, falling back
+// to the well-known testnets, or nil to ask the provider.
+func networkChainID(network config.NetworkConfig) *big.Int {
+	if network.ChainID > 0 {
+		return big.NewInt(network.ChainID)
+	}
+	if value, ok := chainIDMap[strings.ToLower(network.Name)]; ok {
+		return big.NewInt(int64(value))
+	}
+	return nil
+}
+
+func configModTime() time.Time {
+	if *configFlag == "" {
+		return time.Time{}
+	}
+	info, err := os.Stat(*configFlag)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// restartRequired lists the changed settings that cannot be reloaded.
+func restartRequired(old, new *config.Config) []string {
+	var keys []string
+	changed := map[string]bool{
+		"httpport":                old.HTTPPort != new.HTTPPort,
+		"proxycount":              old.ProxyCount != new.ProxyCount,
+		"batch":                   old.Batch != new.Batch,
+		"limiter":                 old.Limiter != new.Limiter,
+		"history":                 old.History != new.History,
+		"wallet":                  !reflect.DeepEqual(old.Wallet, new.Wallet),
+		"admin.listen":            old.Admin.Listen != new.Admin.Listen,
+		"eligibility.activityrpc": old.Eligibility.ActivityRPC != new.Eligibility.ActivityRPC,
+		"networks":                !sameNetworks(old.ResolvedNetworks(), new.ResolvedNetworks()),
+	}
+	for key, ok := range changed {
+		if ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
 }
 
-func getPrivateKeyFromFlags() (*ecdsa.PrivateKey, error) {
-	if *privKeyFlag != "" {
-		hexkey := *privKeyFlag
-		if chain.Has0xPrefix(hexkey) {
-			hexkey = hexkey[2:]
+// sameNetworks reports whether both lists serve the same chains, ignoring
+// the settings that can be reloaded.
+func sameNetworks(a, b []config.NetworkConfig) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Name != b[i].Name || a[i].Provider != b[i].Provider || a[i].ChainID != b[i].ChainID {
+			return false
 		}
-		return crypto.HexToECDSA(hexkey)
-	} else if *keyJSONFlag == "" {
+	}
+	return true
+}
+
+// applyFlags copies the flags set on the command line into cfg, leaving the
+// other settings untouched.
+func applyFlags(cfg *config.Config) error {
+	var err error
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "httpport":
+			cfg.HTTPPort = *httpPortFlag
+		case "proxycount":
+			cfg.ProxyCount = *proxyCntFlag
+		case "faucet.amount":
+			cfg.Faucet.Amount = *payoutFlag
+		case "faucet.minutes":
+			cfg.Faucet.Minutes = *intervalFlag
+		case "faucet.name":
+			cfg.Faucet.Name = *netnameFlag
+		case "faucet.symbol":
+			cfg.Faucet.Symbol = *symbolFlag
+		case "faucet.tokens":
+			var tokens []config.TokenConfig
+			if tokens, err = config.ParseTokens(*tokensFlag); err == nil {
+				cfg.Faucet.Tokens = tokens
+			}
+		case "faucet.minbalance":
+			cfg.Faucet.MinBalance = *minFundsFlag
+		case "faucet.lowbalance":
+			cfg.Faucet.LowBalance = *lowFundsFlag
+		case "faucet.hourlybudget":
+			cfg.Faucet.HourlyBudget = *hourlyFlag
+		case "faucet.dailybudget":
+			cfg.Faucet.DailyBudget = *dailyFlag
+		case "batch.contract":
+			cfg.Batch.Contract = *batchContractFlag
+		case "batch.window":
+			cfg.Batch.Window = *batchWindowFlag
+		case "batch.size":
+			cfg.Batch.Size = *batchSizeFlag
+		case "limiter.backend":
+			cfg.Limiter.Backend = *limiterBackendFlag
+		case "limiter.path":
+			cfg.Limiter.Path = *limiterPathFlag
+		case "limiter.redis":
+			cfg.Limiter.Redis = *limiterRedisFlag
+		case "history.path":
+			cfg.History.Path = *historyPathFlag
+		case "history.retention":
+			cfg.History.Retention = *historyRetentionFlag
+		case "wallet.keyjson":
+			cfg.Wallet.KeyJSON = *keyJSONFlag
+		case "wallet.keypass":
+			cfg.Wallet.KeyPass = *keyPassFlag
+		case "wallet.privkey":
+			cfg.Wallet.PrivKeys = privKeyFlag.values
+		case "wallet.provider":
+			cfg.Wallet.Provider = *providerFlag
+		case "wallet.replaceafter":
+			cfg.Wallet.ReplaceAfter = *replaceFlag
+		case "wallet.maxfee":
+			cfg.Wallet.MaxFee = *maxFeeFlag
+		case "hcaptcha.sitekey":
+			cfg.HCaptcha.SiteKey = *hcaptchaSiteKeyFlag
+		case "hcaptcha.secret":
+			cfg.HCaptcha.Secret = *hcaptchaSecretFlag
+		case "captcha.provider":
+			cfg.Captcha.Provider = *captchaProviderFlag
+		case "captcha.sitekey":
+			cfg.Captcha.SiteKey = *captchaSiteKeyFlag
+		case "captcha.secret":
+			cfg.Captcha.Secret = *captchaSecretFlag
+		case "captcha.verifyurl":
+			cfg.Captcha.VerifyURL = *captchaVerifyURLFlag
+		case "captcha.minscore":
+			cfg.Captcha.MinScore = *captchaMinScoreFlag
+		case "pow.difficulty":
+			cfg.PoW.Difficulty = *powDifficultyFlag
+		case "pow.secret":
+			cfg.PoW.Secret = *powSecretFlag
+		case "pow.ttl":
+			cfg.PoW.TTL = *powTTLFlag
+		case "access.allowlist":
+			cfg.Access.Allowlist = *allowlistFlag
+		case "access.denylist":
+			cfg.Access.Denylist = *denylistFlag
+		case "eligibility.maxbalance":
+			cfg.Eligibility.MaxBalance = *maxBalanceFlag
+		case "eligibility.minnonce":
+			cfg.Eligibility.MinNonce = *minNonceFlag
+		case "eligibility.activityrpc":
+			cfg.Eligibility.ActivityRPC = *activityRPCFlag
+		case "eligibility.activityname":
+			cfg.Eligibility.ActivityName = *activityNameFlag
+		case "eligibility.minactivity":
+			cfg.Eligibility.MinActivity = *minActivityFlag
+		case "auth.secret":
+			cfg.Auth.Secret = *authSecretFlag
+		case "auth.keyfile":
+			cfg.Auth.KeyFile = *authKeyFileFlag
+		case "auth.apikeys":
+			cfg.Auth.APIKeys = authAPIKeysFlag.values
+		case "auth.github.clientid":
+			cfg.Auth.GitHub.ClientID = *githubClientIDFlag
+		case "auth.github.clientsecret":
+			cfg.Auth.GitHub.ClientSecret = *githubSecretFlag
+		case "admin.token":
+			cfg.Admin.Token = *adminTokenFlag
+		case "admin.user":
+			cfg.Admin.User = *adminUserFlag
+		case "admin.password":
+			cfg.Admin.Password = *adminPasswordFlag
+		case "admin.listen":
+			cfg.Admin.Listen = *adminListenFlag
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("-faucet.tokens: %w", err)
+	}
+	return nil
+}
+
+func getPrivateKeys(wallet config.WalletConfig) ([]*ecdsa.PrivateKey, error) {
+	if len(wallet.PrivKeys) > 0 {
+		var privateKeys []*ecdsa.PrivateKey
+		for _, hexkey := range wallet.PrivKeys {
+			if chain.Has0xPrefix(hexkey) {
+				hexkey = hexkey[2:]
+			}
+			privateKey, err := crypto.HexToECDSA(hexkey)
+			if err != nil {
+				return nil, err
+			}
+			privateKeys = append(privateKeys, privateKey)
+		}
+		return privateKeys, nil
+	} else if wallet.KeyJSON == "" {
 		return nil, errors.New("missing private key or keystore")
 	}
 
-	keyfile, err := chain.ResolveKeyfilePath(*keyJSONFlag)
+	keyfiles, err := chain.ResolveKeyfilePaths(wallet.KeyJSON)
 	if err != nil {
 		return nil, err
 	}
-	password, err := os.ReadFile(*keyPassFlag)
+	password, err := os.ReadFile(wallet.KeyPass)
 	if err != nil {
 		return nil, err
 	}
 
-	return chain.DecryptKeyfile(keyfile, strings.TrimRight(string(password), "\r\n"))
+	var privateKeys []*ecdsa.PrivateKey
+	for _, keyfile := range keyfiles {
+		privateKey, err := chain.DecryptKeyfile(keyfile, strings.TrimRight(string(password), "\r\n"))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", keyfile, err)
+		}
+		privateKeys = append(privateKeys, privateKey)
+	}
+	return privateKeys, nil
+}
+
+func getLimitStore(limiter config.LimiterConfig) (server.LimitStore, error) {
+	switch strings.ToLower(limiter.Backend) {
+	case "memory":
+		return server.NewMemoryStore(), nil
+	case "bolt":
+		return server.NewBoltStore(limiter.Path)
+	case "redis":
+		return server.NewRedisStore(limiter.Redis, "eth-faucet:limit:")
+	default:
+		return nil, fmt.Errorf("unknown limiter backend %q", limiter.Backend)
+	}
 }
@@ -0,0 +1,88 @@
+package chain
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// FundsPolicy configures how the faucet behaves as its balance runs low.
+// Nil fields disable the corresponding behaviour.
+type FundsPolicy struct {
+	// MinBalance is the balance below which new claims are refused
+	MinBalance *big.Int
+	// ReduceBelow is the balance below which the payout shrinks in
+	// proportion to the remaining funds
+	ReduceBelow *big.Int
+}
+
+// Low reports whether balance has fallen below the minimum balance.
+func (p FundsPolicy) Low(balance *big.Int) bool {
+	return p.MinBalance != nil && balance.Cmp(p.MinBalance) < 0
+}
+
+// Payout returns payout scaled down by balance/ReduceBelow once the balance
+// drops below ReduceBelow.
+func (p FundsPolicy) Payout(payout, balance *big.Int) *big.Int {
+	if p.ReduceBelow == nil || p.ReduceBelow.Sign() <= 0 || balance.Cmp(p.ReduceBelow) >= 0 {
+		return new(big.Int).Set(payout)
+	}
+	reduced := new(big.Int).Mul(payout, balance)
+	return reduced.Quo(reduced, p.ReduceBelow)
+}
+
+// BalanceWatcher periodically fetches the balance of the funding accounts so
+// requests can check it without a round trip to the node.
+type BalanceWatcher struct {
+	mu       sync.RWMutex
+	builder  TxBuilder
+	interval time.Duration
+	balance  *big.Int
+}
+
+func NewBalanceWatcher(builder TxBuilder, interval time.Duration) *BalanceWatcher {
+	return &BalanceWatcher{
+		builder:  builder,
+		interval: interval,
+	}
+}
+
+// Balance returns the last fetched balance, or false if none is known yet.
+func (w *BalanceWatcher) Balance() (*big.Int, bool) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.balance == nil {
+		return nil, false
+	}
+	return new(big.Int).Set(w.balance), true
+}
+
+func (w *BalanceWatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		w.refresh(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *BalanceWatcher) refresh(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, w.interval)
+	defer cancel()
+
+	balance, err := w.builder.Balance(ctx)
+	if err != nil {
+		log.WithError(err).Warn("Failed to fetch faucet balance")
+		return
+	}
+	w.mu.Lock()
+	w.balance = balance
+	w.mu.Unlock()
+}
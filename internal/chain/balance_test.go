@@ -0,0 +1,60 @@
+package chain
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestFundsPolicy(t *testing.T) {
+	payout := big.NewInt(1000)
+	policy := FundsPolicy{MinBalance: big.NewInt(100), ReduceBelow: big.NewInt(10000)}
+	tests := []struct {
+		name    string
+		policy  FundsPolicy
+		balance *big.Int
+		low     bool
+		want    *big.Int
+	}{
+		{name: "plenty", policy: policy, balance: big.NewInt(20000), want: big.NewInt(1000)},
+		{name: "reduced", policy: policy, balance: big.NewInt(2500), want: big.NewInt(250)},
+		{name: "below minimum", policy: policy, balance: big.NewInt(50), low: true, want: big.NewInt(5)},
+		{name: "disabled", balance: big.NewInt(0), want: big.NewInt(1000)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Low(tt.balance); got != tt.low {
+				t.Errorf("Low() = %v, want %v", got, tt.low)
+			}
+			if got := tt.policy.Payout(payout, tt.balance); got.Cmp(tt.want) != 0 {
+				t.Errorf("Payout() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBalanceWatcher(t *testing.T) {
+	privateKey, _ := crypto.HexToECDSA("976f9f7772781ff6d1c93941129d417c49a209c674056a3cf5e27e225ee55fa8")
+	fromAddress := crypto.PubkeyToAddress(privateKey.PublicKey)
+	simClient := backends.NewSimulatedBackend(
+		core.GenesisAlloc{
+			fromAddress: {Balance: big.NewInt(10000000000000000)},
+		}, 10000000,
+	)
+	defer simClient.Close()
+
+	watcher := NewBalanceWatcher(&TxBuild{client: simClient, fromAddress: fromAddress}, time.Second)
+	if _, ok := watcher.Balance(); ok {
+		t.Error("expected no balance before the first refresh")
+	}
+	watcher.refresh(context.Background())
+	balance, ok := watcher.Balance()
+	if !ok || balance.Cmp(big.NewInt(10000000000000000)) != 0 {
+		t.Errorf("unexpected balance %v", balance)
+	}
+}
@@ -0,0 +1,32 @@
+package chain
+
+import (
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+)
+
+// erc20ABI covers the subset of the ERC-20 interface used by the faucet.
+const erc20ABI = `[
+	{"constant":false,"inputs":[{"name":"to","type":"address"},{"name":"value","type":"uint256"}],"name":"transfer","outputs":[{"name":"","type":"bool"}],"type":"function"},
+	{"constant":true,"inputs":[{"name":"owner","type":"address"}],"name":"balanceOf","outputs":[{"name":"","type":"uint256"}],"type":"function"}
+]`
+
+// disperseABI is the payout function of disperse-style batch payment contracts
+// such as https://disperse.app.
+const disperseABI = `[
+	{"constant":false,"inputs":[{"name":"recipients","type":"address[]"},{"name":"values","type":"uint256[]"}],"name":"disperseEther","outputs":[],"payable":true,"type":"function"}
+]`
+
+var (
+	erc20    = mustParseABI(erc20ABI)
+	disperse = mustParseABI(disperseABI)
+)
+
+func mustParseABI(definition string) abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(definition))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
@@ -0,0 +1,413 @@
+package chain
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/chainflag/eth-faucet/internal/metrics"
+)
+
+type ClaimState string
+
+const (
+	ClaimQueued  ClaimState = "queued"
+	ClaimSending ClaimState = "sending"
+	ClaimSent    ClaimState = "sent"
+	ClaimFailed  ClaimState = "failed"
+)
+
+const (
+	dispatchTimeout = 30 * time.Second
+	claimRetention  = 24 * time.Hour
+)
+
+var ErrQueueFull = errors.New("claim queue is full")
+
+// ClaimRequest describes a payout. A nil Token pays out the native currency.
+type ClaimRequest struct {
+	To    string
+	Token *common.Address
+	Value *big.Int
+}
+
+// BatchPolicy configures paying out native currency claims in batches through
+// a disperse-style contract. A zero Contract disables batching.
+type BatchPolicy struct {
+	Contract common.Address
+	// Window is how long to wait for further claims to join a batch
+	Window  time.Duration
+	MaxSize int
+}
+
+func (p BatchPolicy) enabled() bool {
+	return p.Contract != (common.Address{}) && p.MaxSize > 1
+}
+
+type claim struct {
+	id         string
+	req        ClaimRequest
+	state      ClaimState
+	txHash     common.Hash
+	err        string
+	createdAt  time.Time
+	finishedAt time.Time
+}
+
+type ClaimStatus struct {
+	ID      string
+	Request ClaimRequest
+	// Position is the 1-based place in the queue while the claim is queued
+	Position  int
+	State     ClaimState
+	TxHash    common.Hash
+	Error     string
+	CreatedAt time.Time
+	// FinishedAt is when the claim was sent or failed
+	FinishedAt time.Time
+	// Tx is the status of the sent transaction, if any
+	Tx *TxStatus
+}
+
+// Dispatcher queues claims and sends their transactions in the background,
+// so requests never wait on the node themselves. Claims are sent one at a
+// time, or by one worker per funding account when the builder sends from
+// several. With a batch policy, consecutive native currency claims share one
+// transaction.
+type Dispatcher struct {
+	mu       sync.Mutex
+	builder  TxBuilder
+	capacity int
+	batch    BatchPolicy
+	workers  int
+	queue    []*claim
+	claims   map[string]*claim
+	wake     chan struct{}
+	watchers []func(*ClaimStatus)
+}
+
+// multiAccount is implemented by builders sending from several funding
+// accounts, such as the AccountPool.
+type multiAccount interface {
+	Accounts() int
+}
+
+func NewDispatcher(builder TxBuilder, capacity int, batch BatchPolicy) *Dispatcher {
+	workers := 1
+	if pool, ok := builder.(multiAccount); ok && pool.Accounts() > 1 {
+		workers = pool.Accounts()
+	}
+	return &Dispatcher{
+		builder:  builder,
+		capacity: capacity,
+		batch:    batch,
+		workers:  workers,
+		claims:   make(map[string]*claim),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Enqueue adds a claim to the end of the queue and returns its ID and position.
+func (d *Dispatcher) Enqueue(req ClaimRequest) (string, int, error) {
+	id, err := newClaimID()
+	if err != nil {
+		return "", 0, err
+	}
+
+	d.mu.Lock()
+	if len(d.queue) >= d.capacity {
+		d.mu.Unlock()
+		return "", 0, ErrQueueFull
+	}
+	c := &claim{id: id, req: req, state: ClaimQueued, createdAt: time.Now()}
+	d.queue = append(d.queue, c)
+	d.claims[id] = c
+	position := len(d.queue)
+	d.mu.Unlock()
+
+	d.signal()
+	return id, position, nil
+}
+
+// signal wakes an idle worker, if there is one.
+func (d *Dispatcher) signal() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// OnUpdate registers fn to be called with the status of every claim once it
+// has been sent or has failed, including claims still queued when the
+// dispatcher stops. fn is called from the dispatching goroutines,
+// so it must not block.
+func (d *Dispatcher) OnUpdate(fn func(*ClaimStatus)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.watchers = append(d.watchers, fn)
+}
+
+func (d *Dispatcher) Depth() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.queue)
+}
+
+func (d *Dispatcher) Status(id string) (*ClaimStatus, bool) {
+	d.mu.Lock()
+	c, ok := d.claims[id]
+	if !ok {
+		d.mu.Unlock()
+		return nil, false
+	}
+	status := d.status(c)
+	d.mu.Unlock()
+
+	if status.State == ClaimSent {
+		status.Tx, _ = d.builder.Status(status.TxHash)
+	}
+	return status, true
+}
+
+// Recent returns up to limit of the claims made in the last day, newest first.
+func (d *Dispatcher) Recent(limit int) []*ClaimStatus {
+	d.mu.Lock()
+	claims := make([]*claim, 0, len(d.claims))
+	for _, c := range d.claims {
+		claims = append(claims, c)
+	}
+	sort.Slice(claims, func(i, j int) bool {
+		return claims[i].createdAt.After(claims[j].createdAt)
+	})
+	if len(claims) > limit {
+		claims = claims[:limit]
+	}
+	statuses := make([]*ClaimStatus, len(claims))
+	for i, c := range claims {
+		statuses[i] = d.status(c)
+	}
+	d.mu.Unlock()
+
+	for _, status := range statuses {
+		if status.State == ClaimSent {
+			status.Tx, _ = d.builder.Status(status.TxHash)
+		}
+	}
+	return statuses
+}
+
+// status must be called with d.mu held.
+func (d *Dispatcher) status(c *claim) *ClaimStatus {
+	status := &ClaimStatus{
+		ID:         c.id,
+		Request:    c.req,
+		State:      c.state,
+		TxHash:     c.txHash,
+		Error:      c.err,
+		CreatedAt:  c.createdAt,
+		FinishedAt: c.finishedAt,
+	}
+	if c.state == ClaimQueued {
+		for i, queued := range d.queue {
+			if queued == c {
+				status.Position = i + 1
+				break
+			}
+		}
+	}
+	return status
+}
+
+// Run dispatches claims until ctx is done, then fails the claims still
+// queued once the workers have stopped.
+func (d *Dispatcher) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < d.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.work(ctx)
+		}()
+	}
+
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			d.abandon()
+			return
+		case <-ticker.C:
+			d.prune()
+		}
+	}
+}
+
+func (d *Dispatcher) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.wake:
+			d.drain(ctx)
+		}
+	}
+}
+
+func (d *Dispatcher) drain(ctx context.Context) {
+	if d.batch.enabled() && d.Depth() < d.batch.MaxSize {
+		// Give further claims a chance to join the batch
+		timer := time.NewTimer(d.batch.Window)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+	}
+
+	for ctx.Err() == nil {
+		batch := d.pop()
+		if len(batch) == 0 {
+			return
+		}
+		// Let another worker send the next claims meanwhile
+		if d.Depth() > 0 {
+			d.signal()
+		}
+		d.dispatch(ctx, batch)
+	}
+}
+
+// pop takes the next claims off the queue: a run of native currency claims
+// up to the batch size when batching, and a single claim otherwise.
+func (d *Dispatcher) pop() []*claim {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	n := 0
+	if len(d.queue) > 0 {
+		n = 1
+	}
+	if d.batch.enabled() {
+		for n < len(d.queue) && n < d.batch.MaxSize && d.queue[0].req.Token == nil && d.queue[n].req.Token == nil {
+			n++
+		}
+	}
+
+	batch := make([]*claim, n)
+	copy(batch, d.queue[:n])
+	for i := 0; i < n; i++ {
+		d.queue[i] = nil
+		batch[i].state = ClaimSending
+	}
+	d.queue = d.queue[n:]
+	return batch
+}
+
+func (d *Dispatcher) dispatch(ctx context.Context, batch []*claim) {
+	ctx, cancel := context.WithTimeout(ctx, dispatchTimeout)
+	defer cancel()
+
+	var txHash common.Hash
+	var err error
+	if c := batch[0]; len(batch) > 1 {
+		recipients := make([]common.Address, len(batch))
+		values := make([]*big.Int, len(batch))
+		for i, c := range batch {
+			recipients[i] = common.HexToAddress(c.req.To)
+			values[i] = c.req.Value
+		}
+		txHash, err = d.builder.Disperse(ctx, d.batch.Contract, recipients, values)
+	} else if c.req.Token == nil {
+		txHash, err = d.builder.Transfer(ctx, c.req.To, c.req.Value)
+	} else {
+		txHash, err = d.builder.TransferToken(ctx, *c.req.Token, c.req.To, c.req.Value)
+	}
+
+	d.mu.Lock()
+	statuses := make([]*ClaimStatus, len(batch))
+	for i, c := range batch {
+		c.finishedAt = time.Now()
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":   err,
+				"claimID": c.id,
+				"address": c.req.To,
+			}).Error("Failed to send transaction")
+			metrics.ClaimsRejected.WithLabelValues(metrics.ReasonTxFailed).Inc()
+			c.state = ClaimFailed
+			c.err = err.Error()
+			statuses[i] = d.status(c)
+			continue
+		}
+
+		log.WithFields(log.Fields{
+			"txHash":  txHash,
+			"claimID": c.id,
+			"address": c.req.To,
+			"batch":   len(batch),
+		}).Info("Transaction sent successfully")
+		c.state = ClaimSent
+		c.txHash = txHash
+		statuses[i] = d.status(c)
+	}
+	watchers := d.watchers
+	d.mu.Unlock()
+	notify(watchers, statuses)
+}
+
+// abandon fails the claims still queued when the dispatcher stops.
+func (d *Dispatcher) abandon() {
+	d.mu.Lock()
+	if len(d.queue) > 0 {
+		log.WithField("depth", len(d.queue)).Warn("Dispatcher stopped with claims still queued")
+	}
+	statuses := make([]*ClaimStatus, len(d.queue))
+	for i, c := range d.queue {
+		c.state = ClaimFailed
+		c.err = "faucet shut down before the claim was sent"
+		c.finishedAt = time.Now()
+		statuses[i] = d.status(c)
+	}
+	d.queue = nil
+	watchers := d.watchers
+	d.mu.Unlock()
+	notify(watchers, statuses)
+}
+
+func notify(watchers []func(*ClaimStatus), statuses []*ClaimStatus) {
+	for _, status := range statuses {
+		for _, fn := range watchers {
+			fn(status)
+		}
+	}
+}
+
+func (d *Dispatcher) prune() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for id, c := range d.claims {
+		if !c.finishedAt.IsZero() && time.Since(c.finishedAt) > claimRetention {
+			delete(d.claims, id)
+		}
+	}
+}
+
+func newClaimID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
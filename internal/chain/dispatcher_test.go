@@ -0,0 +1,267 @@
+package chain
+
+import (
+	"context"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/agiledragon/gomonkey/v2"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestDispatcher(t *testing.T) {
+	privateKey, _ := crypto.HexToECDSA("976f9f7772781ff6d1c93941129d417c49a209c674056a3cf5e27e225ee55fa8")
+	fromAddress := crypto.PubkeyToAddress(privateKey.PublicKey)
+	simClient := backends.NewSimulatedBackend(
+		core.GenesisAlloc{
+			fromAddress: {Balance: big.NewInt(10000000000000000)},
+		}, 10000000,
+	)
+	defer simClient.Close()
+	var s *backends.SimulatedBackend
+	patches := gomonkey.ApplyMethod(reflect.TypeOf(s), "SuggestGasPrice", func(_ *backends.SimulatedBackend, _ context.Context) (*big.Int, error) {
+		return big.NewInt(875000000), nil
+	})
+	defer patches.Reset()
+
+	txBuilder := &TxBuild{
+		client:          simClient,
+		privateKey:      privateKey,
+		signer:          types.NewLondonSigner(big.NewInt(1337)),
+		fromAddress:     fromAddress,
+		supportsEIP1559: false,
+		tracker:         NewTracker(simClient, time.Second),
+	}
+	dispatcher := NewDispatcher(txBuilder, 3, BatchPolicy{})
+
+	recipients := []common.Address{
+		common.HexToAddress("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B"),
+		common.HexToAddress("0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045"),
+	}
+	var ids []string
+	for i, recipient := range recipients {
+		id, position, err := dispatcher.Enqueue(ClaimRequest{To: recipient.Hex(), Value: big.NewInt(1000)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if position != i+1 {
+			t.Errorf("expected position %d, got %d", i+1, position)
+		}
+		ids = append(ids, id)
+	}
+	invalidID, _, _ := dispatcher.Enqueue(ClaimRequest{To: recipients[0].Hex(), Value: big.NewInt(0)})
+	if _, _, err := dispatcher.Enqueue(ClaimRequest{To: recipients[0].Hex(), Value: big.NewInt(1)}); err != ErrQueueFull {
+		t.Errorf("expected full queue error, got %v", err)
+	}
+	if depth := dispatcher.Depth(); depth != 3 {
+		t.Errorf("expected queue depth 3, got %d", depth)
+	}
+	if status, _ := dispatcher.Status(ids[1]); status.State != ClaimQueued || status.Position != 2 {
+		t.Errorf("unexpected status of queued claim: %+v", status)
+	}
+	if recent := dispatcher.Recent(10); len(recent) != 3 || len(dispatcher.Recent(2)) != 2 {
+		t.Errorf("expected the three accepted claims among the recent ones, got %d", len(recent))
+	}
+
+	updates := make(chan *ClaimStatus, 3)
+	dispatcher.OnUpdate(func(status *ClaimStatus) { updates <- status })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go dispatcher.Run(ctx)
+	deadline := time.Now().Add(time.Second)
+	for dispatcher.Depth() > 0 || !isSettled(dispatcher, invalidID) {
+		if time.Now().After(deadline) {
+			t.Fatal("dispatcher did not drain the queue")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	simClient.Commit()
+
+	block, err := simClient.BlockByNumber(ctx, big.NewInt(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, id := range ids {
+		status, _ := dispatcher.Status(id)
+		if status.State != ClaimSent {
+			t.Fatalf("unexpected status of dispatched claim: %+v", status)
+		}
+		tx := block.Transactions()[i]
+		if tx.Hash() != status.TxHash || tx.Nonce() != uint64(i) || *tx.To() != recipients[i] {
+			t.Errorf("claim %d was not sent in queue order", i)
+		}
+	}
+	if status, _ := dispatcher.Status(invalidID); status.State != ClaimFailed || status.Error == "" {
+		t.Errorf("unexpected status of invalid claim: %+v", status)
+	}
+	for range append(ids, invalidID) {
+		select {
+		case status := <-updates:
+			if status.State != ClaimSent && status.State != ClaimFailed {
+				t.Errorf("unexpected update of claim: %+v", status)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expected an update for every dispatched claim")
+		}
+	}
+
+	// Claims still queued when the dispatcher stops are failed
+	stopped := NewDispatcher(txBuilder, 1, BatchPolicy{})
+	stopped.OnUpdate(func(status *ClaimStatus) { updates <- status })
+	droppedID, _, _ := stopped.Enqueue(ClaimRequest{To: recipients[0].Hex(), Value: big.NewInt(1000)})
+	stopped.abandon()
+	if status := <-updates; status.ID != droppedID || status.State != ClaimFailed || stopped.Depth() != 0 {
+		t.Errorf("unexpected update of dropped claim: %+v", status)
+	}
+}
+
+func isSettled(dispatcher *Dispatcher, id string) bool {
+	status, _ := dispatcher.Status(id)
+	return status.State == ClaimSent || status.State == ClaimFailed
+}
+
+func TestDispatcherBatch(t *testing.T) {
+	privateKey, _ := crypto.HexToECDSA("976f9f7772781ff6d1c93941129d417c49a209c674056a3cf5e27e225ee55fa8")
+	fromAddress := crypto.PubkeyToAddress(privateKey.PublicKey)
+	simClient := backends.NewSimulatedBackend(
+		core.GenesisAlloc{
+			fromAddress: {Balance: big.NewInt(10000000000000000)},
+		}, 10000000,
+	)
+	defer simClient.Close()
+	var s *backends.SimulatedBackend
+	patches := gomonkey.ApplyMethod(reflect.TypeOf(s), "SuggestGasPrice", func(_ *backends.SimulatedBackend, _ context.Context) (*big.Int, error) {
+		return big.NewInt(875000000), nil
+	})
+	defer patches.Reset()
+
+	txBuilder := &TxBuild{
+		client:          simClient,
+		privateKey:      privateKey,
+		signer:          types.NewLondonSigner(big.NewInt(1337)),
+		fromAddress:     fromAddress,
+		supportsEIP1559: false,
+		tracker:         NewTracker(simClient, time.Second),
+	}
+	disperseAddress := common.HexToAddress("0xD152f549545093347A162Dce210e7293f1452150")
+	tokenAddress := common.HexToAddress("0x6B175474E89094C44Da98b954EedeAC495271d0F")
+	dispatcher := NewDispatcher(txBuilder, 10, BatchPolicy{Contract: disperseAddress, Window: 10 * time.Millisecond, MaxSize: 2})
+
+	recipients := []common.Address{
+		common.HexToAddress("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B"),
+		common.HexToAddress("0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045"),
+		common.HexToAddress("0x1c7D4B196Cb0C7B01d743Fbc6116a902379C7238"),
+	}
+	var ids []string
+	for _, recipient := range recipients {
+		id, _, _ := dispatcher.Enqueue(ClaimRequest{To: recipient.Hex(), Value: big.NewInt(1000)})
+		ids = append(ids, id)
+	}
+	tokenID, _, _ := dispatcher.Enqueue(ClaimRequest{To: recipients[0].Hex(), Token: &tokenAddress, Value: big.NewInt(5)})
+	ids = append(ids, tokenID)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go dispatcher.Run(ctx)
+	deadline := time.Now().Add(time.Second)
+	for !isSettled(dispatcher, tokenID) {
+		if time.Now().After(deadline) {
+			t.Fatal("dispatcher did not drain the queue")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	simClient.Commit()
+
+	var statuses []*ClaimStatus
+	for _, id := range ids {
+		status, _ := dispatcher.Status(id)
+		if status.State != ClaimSent {
+			t.Fatalf("unexpected status of dispatched claim: %+v", status)
+		}
+		statuses = append(statuses, status)
+	}
+	if statuses[0].TxHash != statuses[1].TxHash {
+		t.Error("expected the first two claims to share a batch transaction")
+	}
+	if statuses[2].TxHash == statuses[1].TxHash || statuses[3].TxHash == statuses[2].TxHash {
+		t.Error("expected claims beyond the batch size and token claims to be sent separately")
+	}
+
+	block, err := simClient.BlockByNumber(ctx, big.NewInt(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	batchTx := block.Transactions()[0]
+	if batchTx.Hash() != statuses[0].TxHash || *batchTx.To() != disperseAddress || batchTx.Value().Cmp(big.NewInt(2000)) != 0 {
+		t.Errorf("unexpected batch transaction to %v with value %v", batchTx.To(), batchTx.Value())
+	}
+	args, err := disperse.Methods["disperseEther"].Inputs.Unpack(batchTx.Data()[4:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := args[0].([]common.Address); !reflect.DeepEqual(got, recipients[:2]) {
+		t.Errorf("unexpected batch recipients %v", got)
+	}
+}
+
+// blockingPool stands in for a pool of two accounts whose transfers wait to
+// be released.
+type blockingPool struct {
+	TxBuilder
+	started chan string
+	release chan struct{}
+}
+
+func (p *blockingPool) Accounts() int { return 2 }
+
+func (p *blockingPool) Status(common.Hash) (*TxStatus, bool) { return nil, false }
+
+func (p *blockingPool) Transfer(ctx context.Context, to string, _ *big.Int) (common.Hash, error) {
+	p.started <- to
+	select {
+	case <-p.release:
+		return common.HexToHash(to), nil
+	case <-ctx.Done():
+		return common.Hash{}, ctx.Err()
+	}
+}
+
+func TestDispatcherWorkers(t *testing.T) {
+	pool := &blockingPool{started: make(chan string, 2), release: make(chan struct{})}
+	dispatcher := NewDispatcher(pool, 10, BatchPolicy{})
+	recipients := []string{"0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", "0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045"}
+	var ids []string
+	for _, recipient := range recipients {
+		id, _, _ := dispatcher.Enqueue(ClaimRequest{To: recipient, Value: big.NewInt(1000)})
+		ids = append(ids, id)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go dispatcher.Run(ctx)
+	// Both claims are sent at once, one through each account
+	for range recipients {
+		select {
+		case <-pool.started:
+		case <-time.After(time.Second):
+			t.Fatal("expected the claims to be sent concurrently")
+		}
+	}
+	close(pool.release)
+	deadline := time.Now().Add(time.Second)
+	for _, id := range ids {
+		for !isSettled(dispatcher, id) {
+			if time.Now().After(deadline) {
+				t.Fatal("dispatcher did not drain the queue")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
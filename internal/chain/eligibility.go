@@ -0,0 +1,104 @@
+package chain
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// AccountReader reads the state of arbitrary accounts from a node.
+type AccountReader interface {
+	BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error)
+	NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error)
+}
+
+// EligibilityPolicy restricts claims to recipients that look like genuine
+// users rather than freshly generated addresses. Zero values disable the
+// corresponding check.
+type EligibilityPolicy struct {
+	// MaxBalance is the recipient balance above which claims are refused
+	MaxBalance *big.Int
+	// MinNonce is the number of transactions the recipient must have sent
+	// on the faucet network
+	MinNonce uint64
+	// MinActivity is the number of transactions the recipient must have
+	// sent on the activity network, such as mainnet
+	MinActivity uint64
+}
+
+// Enabled reports whether any check is configured.
+func (p EligibilityPolicy) Enabled() bool {
+	return p.MaxBalance != nil || p.MinNonce > 0 || p.MinActivity > 0
+}
+
+// Requirement names an eligibility check.
+type Requirement string
+
+const (
+	RequireMaxBalance  Requirement = "max_balance"
+	RequireMinNonce    Requirement = "min_nonce"
+	RequireMinActivity Requirement = "min_activity"
+)
+
+// IneligibleError reports the requirement a recipient failed, with the value
+// found on chain and the one the policy asks for.
+type IneligibleError struct {
+	Requirement Requirement
+	Have        *big.Int
+	Want        *big.Int
+}
+
+func (e *IneligibleError) Error() string {
+	return fmt.Sprintf("recipient fails %s: have %s, want %s", e.Requirement, e.Have, e.Want)
+}
+
+// EligibilityChecker checks recipients against an EligibilityPolicy using
+// the faucet network and, optionally, a separate activity network.
+type EligibilityChecker struct {
+	client   AccountReader
+	activity AccountReader
+}
+
+// NewEligibilityChecker returns a checker reading from client. activity may
+// be nil, in which case the MinActivity requirement is not checked.
+func NewEligibilityChecker(client, activity AccountReader) *EligibilityChecker {
+	return &EligibilityChecker{
+		client:   client,
+		activity: activity,
+	}
+}
+
+// Check returns an *IneligibleError if address fails any requirement of
+// policy, or another error if the node could not be queried.
+func (c *EligibilityChecker) Check(ctx context.Context, address common.Address, policy EligibilityPolicy) error {
+	if policy.MaxBalance != nil {
+		balance, err := c.client.BalanceAt(ctx, address, nil)
+		if err != nil {
+			return countRPCError("eth_getBalance", err)
+		}
+		if balance.Cmp(policy.MaxBalance) > 0 {
+			return &IneligibleError{Requirement: RequireMaxBalance, Have: balance, Want: policy.MaxBalance}
+		}
+	}
+	if policy.MinNonce > 0 {
+		nonce, err := c.client.NonceAt(ctx, address, nil)
+		if err != nil {
+			return countRPCError("eth_getTransactionCount", err)
+		}
+		if nonce < policy.MinNonce {
+			return &IneligibleError{Requirement: RequireMinNonce, Have: new(big.Int).SetUint64(nonce), Want: new(big.Int).SetUint64(policy.MinNonce)}
+		}
+	}
+	if policy.MinActivity > 0 && c.activity != nil {
+		nonce, err := c.activity.NonceAt(ctx, address, nil)
+		if err != nil {
+			return fmt.Errorf("activity network: %w", err)
+		}
+		if nonce < policy.MinActivity {
+			return &IneligibleError{Requirement: RequireMinActivity, Have: new(big.Int).SetUint64(nonce), Want: new(big.Int).SetUint64(policy.MinActivity)}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+)
+
+func TestEligibilityChecker(t *testing.T) {
+	fresh := common.HexToAddress("0x1000000000000000000000000000000000000001")
+	active := common.HexToAddress("0x1000000000000000000000000000000000000002")
+	rich := common.HexToAddress("0x1000000000000000000000000000000000000003")
+	faucetClient := backends.NewSimulatedBackend(
+		core.GenesisAlloc{
+			active: {Balance: big.NewInt(100), Nonce: 5},
+			rich:   {Balance: big.NewInt(5000), Nonce: 5},
+		}, 10000000,
+	)
+	defer faucetClient.Close()
+	activityClient := backends.NewSimulatedBackend(
+		core.GenesisAlloc{
+			active: {Balance: big.NewInt(0), Nonce: 2},
+		}, 10000000,
+	)
+	defer activityClient.Close()
+
+	checker := NewEligibilityChecker(faucetClient, activityClient)
+	tests := []struct {
+		name        string
+		address     common.Address
+		policy      EligibilityPolicy
+		requirement Requirement
+	}{
+		{name: "disabled", address: fresh},
+		{name: "below balance cap", address: active, policy: EligibilityPolicy{MaxBalance: big.NewInt(1000)}},
+		{name: "above balance cap", address: rich, policy: EligibilityPolicy{MaxBalance: big.NewInt(1000)}, requirement: RequireMaxBalance},
+		{name: "enough transactions", address: active, policy: EligibilityPolicy{MinNonce: 5}},
+		{name: "fresh address", address: fresh, policy: EligibilityPolicy{MinNonce: 1}, requirement: RequireMinNonce},
+		{name: "active elsewhere", address: active, policy: EligibilityPolicy{MinActivity: 2}},
+		{name: "inactive elsewhere", address: rich, policy: EligibilityPolicy{MinActivity: 1}, requirement: RequireMinActivity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checker.Check(context.Background(), tt.address, tt.policy)
+			if tt.requirement == "" {
+				if err != nil {
+					t.Fatalf("Check() unexpected error: %v", err)
+				}
+				return
+			}
+			var ineligible *IneligibleError
+			if !errors.As(err, &ineligible) || ineligible.Requirement != tt.requirement {
+				t.Fatalf("Check() = %v, want %s failure", err, tt.requirement)
+			}
+		})
+	}
+
+	// Without an activity network the requirement cannot be checked
+	if err := NewEligibilityChecker(faucetClient, nil).Check(context.Background(), fresh, EligibilityPolicy{MinActivity: 1}); err != nil {
+		t.Errorf("Check() without activity network = %v", err)
+	}
+}
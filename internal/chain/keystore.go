@@ -24,25 +24,26 @@ func DecryptKeyfile(keyfile, password string) (*ecdsa.PrivateKey, error) {
 	return key.PrivateKey, nil
 }
 
-func ResolveKeyfilePath(keydir string) (string, error) {
+// ResolveKeyfilePaths returns every keyfile in keydir, or keydir itself if it is a file.
+func ResolveKeyfilePaths(keydir string) ([]string, error) {
 	keydir, _ = filepath.Abs(keydir)
 	fileInfo, err := os.Stat(keydir)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	if !fileInfo.IsDir() {
-		return keydir, nil
+		return []string{keydir}, nil
 	}
 
+	var keyfiles []string
 	files, _ := os.ReadDir(keydir)
 	for _, file := range files {
-		if file.IsDir() {
-			continue
-		}
-		if strings.HasPrefix(file.Name(), "UTC--") {
-			return filepath.Join(keydir, file.Name()), nil
+		if !file.IsDir() && strings.HasPrefix(file.Name(), "UTC--") {
+			keyfiles = append(keyfiles, filepath.Join(keydir, file.Name()))
 		}
 	}
-
-	return "", fmt.Errorf("keyfile is not in %s", keydir)
+	if len(keyfiles) == 0 {
+		return nil, fmt.Errorf("keyfile is not in %s", keydir)
+	}
+	return keyfiles, nil
 }
@@ -54,38 +54,45 @@ func TestDecryptKeyfile(t *testing.T) {
 	}
 }
 
-func TestResolveKeyfilePath(t *testing.T) {
+func TestResolveKeyfilePaths(t *testing.T) {
 	tests := []struct {
 		name    string
 		keydir  string
-		want    string
+		want    []string
 		wantErr bool
 	}{
 		{
 			name:    "directory",
 			keydir:  "testdata/keystore",
-			want:    "UTC--2016-03-22T12-57-55.920751759Z--7ef5a6135f1fd6a02593eedc869c6d41d934aef8",
+			want:    []string{"UTC--2016-03-22T12-57-55.920751759Z--7ef5a6135f1fd6a02593eedc869c6d41d934aef8"},
+			wantErr: false,
+		},
+		{
+			name:    "file",
+			keydir:  "testdata/keystore/empty",
+			want:    []string{"empty"},
 			wantErr: false,
 		},
 		{
 			name:    "notfound",
 			keydir:  "testdata/keystore/null",
-			want:    "",
+			want:    nil,
 			wantErr: true,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := ResolveKeyfilePath(tt.keydir)
-			if tt.name != "notfound" {
-				got = filepath.Base(got)
-			}
+			got, err := ResolveKeyfilePaths(tt.keydir)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("ResolveKeyfilePath() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("ResolveKeyfilePaths() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if got != tt.want {
-				t.Errorf("ResolveKeyfilePath() got = %v, want %v", got, tt.want)
+			var names []string
+			for _, path := range got {
+				names = append(names, filepath.Base(path))
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("ResolveKeyfilePaths() got = %v, want %v", names, tt.want)
 			}
 		})
 	}
@@ -0,0 +1,249 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	balanceRefreshInterval = 30 * time.Second
+	// stuckAccountAge is how long a transaction may stay pending before its
+	// account is considered stuck and skipped.
+	stuckAccountAge = 2 * time.Minute
+)
+
+// Gas reserved for a payout when picking the account to send it from, as
+// its actual gas limit is only known once the transaction is built.
+const (
+	reserveTransferGas = 21000
+	reserveTokenGas    = 100000
+	// reserveDisperseGas is reserved per recipient of a batch
+	reserveDisperseGas = 40000
+)
+
+var ErrNoAccount = errors.New("no funding account is able to cover the payout")
+
+// AccountPool spreads claims round-robin across several funding accounts,
+// each with its own nonce sequence. Accounts that cannot cover a payout or
+// have transactions stuck in the mempool are skipped.
+type AccountPool struct {
+	mu       sync.Mutex
+	builders []*TxBuild
+	balances []*big.Int
+	// gasPrice is the gas price suggested by the node at the last refresh
+	gasPrice *big.Int
+	next     int
+}
+
+func NewAccountPool(builders []*TxBuild) *AccountPool {
+	return &AccountPool{
+		builders: builders,
+		balances: make([]*big.Int, len(builders)),
+	}
+}
+
+// Sender returns the primary account of the pool.
+func (p *AccountPool) Sender() common.Address {
+	return p.builders[0].Sender()
+}
+
+func (p *AccountPool) Transfer(ctx context.Context, to string, value *big.Int) (common.Hash, error) {
+	return p.withAccount(value, reserveTransferGas, func(b *TxBuild) (common.Hash, error) {
+		return b.Transfer(ctx, to, value)
+	})
+}
+
+func (p *AccountPool) TransferToken(ctx context.Context, token common.Address, to string, value *big.Int) (common.Hash, error) {
+	return p.withAccount(new(big.Int), reserveTokenGas, func(b *TxBuild) (common.Hash, error) {
+		return b.TransferToken(ctx, token, to, value)
+	})
+}
+
+func (p *AccountPool) Disperse(ctx context.Context, contract common.Address, recipients []common.Address, values []*big.Int) (common.Hash, error) {
+	total := new(big.Int)
+	for _, value := range values {
+		if value != nil {
+			total.Add(total, value)
+		}
+	}
+	gas := reserveTransferGas + reserveDisperseGas*uint64(len(recipients))
+	return p.withAccount(total, gas, func(b *TxBuild) (common.Hash, error) {
+		return b.Disperse(ctx, contract, recipients, values)
+	})
+}
+
+// Accounts returns the number of funding accounts in the pool.
+func (p *AccountPool) Accounts() int {
+	return len(p.builders)
+}
+
+// Balance returns the native currency balance held across all accounts.
+func (p *AccountPool) Balance(ctx context.Context) (*big.Int, error) {
+	total := new(big.Int)
+	for _, b := range p.builders {
+		balance, err := b.Balance(ctx)
+		if err != nil {
+			return nil, err
+		}
+		total.Add(total, balance)
+	}
+	return total, nil
+}
+
+// TokenBalance returns the token balance held across all accounts.
+func (p *AccountPool) TokenBalance(ctx context.Context, token common.Address) (*big.Int, error) {
+	total := new(big.Int)
+	for _, b := range p.builders {
+		balance, err := b.TokenBalance(ctx, token)
+		if err != nil {
+			return nil, err
+		}
+		total.Add(total, balance)
+	}
+	return total, nil
+}
+
+func (p *AccountPool) Status(hash common.Hash) (*TxStatus, bool) {
+	for _, b := range p.builders {
+		if status, ok := b.Status(hash); ok {
+			return status, true
+		}
+	}
+	return nil, false
+}
+
+// RefreshNonce resynchronizes the nonce of every account in the pool.
+func (p *AccountPool) RefreshNonce(ctx context.Context) error {
+	for _, b := range p.builders {
+		if err := b.RefreshNonce(ctx); err != nil {
+			return fmt.Errorf("%s: %w", b.Sender().Hex(), err)
+		}
+	}
+	return nil
+}
+
+func (p *AccountPool) Run(ctx context.Context) {
+	ticker := time.NewTicker(balanceRefreshInterval)
+	defer ticker.Stop()
+	for {
+		p.refreshBalances(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *AccountPool) refreshBalances(ctx context.Context) {
+	if gasPrice, err := p.builders[0].client.SuggestGasPrice(ctx); err != nil {
+		log.WithError(err).Warn("Failed to refresh gas price")
+	} else {
+		p.mu.Lock()
+		p.gasPrice = gasPrice
+		p.mu.Unlock()
+	}
+	for i, b := range p.builders {
+		balance, err := b.Balance(ctx)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"address": b.Sender(),
+				"error":   err,
+			}).Warn("Failed to refresh account balance")
+			continue
+		}
+		p.mu.Lock()
+		p.balances[i] = balance
+		p.mu.Unlock()
+	}
+}
+
+// withAccount sends through the next healthy account that can cover value
+// and the gas of the transaction, moving on to the following one if the node
+// reports that the account ran out of funds.
+func (p *AccountPool) withAccount(value *big.Int, gas uint64, send func(*TxBuild) (common.Hash, error)) (common.Hash, error) {
+	if value == nil {
+		value = new(big.Int)
+	}
+	lastErr := ErrNoAccount
+	for attempt := 0; attempt < len(p.builders); attempt++ {
+		index := p.pick(value, gas)
+		if index < 0 {
+			break
+		}
+
+		txHash, err := send(p.builders[index])
+		if err == nil {
+			p.spend(index, value)
+			return txHash, nil
+		}
+		if !strings.Contains(strings.ToLower(err.Error()), "insufficient funds") {
+			return common.Hash{}, err
+		}
+		log.WithField("address", p.builders[index].Sender()).Warn("Funding account ran out of funds, rotating to the next one")
+		p.mu.Lock()
+		p.balances[index] = new(big.Int)
+		p.mu.Unlock()
+		lastErr = err
+	}
+	return common.Hash{}, lastErr
+}
+
+// pick returns the index of the next account that can cover value and the
+// given gas and has no stuck transactions, or -1 if there is none.
+func (p *AccountPool) pick(value *big.Int, gas uint64) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Until the gas price is known, the balance only has to exceed the value
+	need, minCmp := value, 1
+	if fee := p.gasFee(); fee != nil {
+		need = new(big.Int).Mul(fee, new(big.Int).SetUint64(gas))
+		need.Add(need, value)
+		minCmp = 0
+	}
+	for i := 0; i < len(p.builders); i++ {
+		index := (p.next + i) % len(p.builders)
+		if balance := p.balances[index]; balance != nil && balance.Cmp(need) < minCmp {
+			continue
+		}
+		if len(p.builders[index].tracker.Stuck(stuckAccountAge)) > 0 {
+			continue
+		}
+		p.next = index + 1
+		return index
+	}
+	return -1
+}
+
+// gasFee returns the highest fee per gas a transaction may pay: the fee
+// ceiling of the replacement policy if any, or else twice the suggested gas
+// price, as fee caps are set to twice the base fee plus the tip. It returns
+// nil while the gas price is unknown. It must be called with p.mu held.
+func (p *AccountPool) gasFee() *big.Int {
+	if maxFee := p.builders[0].policy.MaxFee; maxFee != nil {
+		return maxFee
+	}
+	if p.gasPrice == nil {
+		return nil
+	}
+	return new(big.Int).Mul(p.gasPrice, big.NewInt(2))
+}
+
+// spend deducts value from the cached balance until the next refresh.
+func (p *AccountPool) spend(index int, value *big.Int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if balance := p.balances[index]; balance != nil {
+		p.balances[index] = new(big.Int).Sub(balance, value)
+	}
+}
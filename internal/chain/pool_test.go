@@ -0,0 +1,148 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/agiledragon/gomonkey/v2"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestAccountPool(t *testing.T) {
+	keys := []string{
+		"976f9f7772781ff6d1c93941129d417c49a209c674056a3cf5e27e225ee55fa8",
+		"8a1f9a8f95be41cd7ccb6168179afb4504aefe388d1e14474d32c45c72ce7b7a",
+		"289c2857d4598e37fb9647507e47a309d6133539bf21a8b9cb6df88fd5232032",
+	}
+	alloc := core.GenesisAlloc{}
+	var builders []*TxBuild
+	for i, key := range keys {
+		privateKey, _ := crypto.HexToECDSA(key)
+		fromAddress := crypto.PubkeyToAddress(privateKey.PublicKey)
+		// The second account is left without funds
+		if i != 1 {
+			alloc[fromAddress] = core.GenesisAccount{Balance: big.NewInt(10000000000000000)}
+		}
+		builders = append(builders, &TxBuild{
+			privateKey:      privateKey,
+			signer:          types.NewLondonSigner(big.NewInt(1337)),
+			fromAddress:     fromAddress,
+			supportsEIP1559: false,
+		})
+	}
+	simClient := backends.NewSimulatedBackend(alloc, 10000000)
+	defer simClient.Close()
+	for _, b := range builders {
+		b.client = simClient
+		b.tracker = NewTracker(simClient, time.Second)
+	}
+	var s *backends.SimulatedBackend
+	patches := gomonkey.ApplyMethod(reflect.TypeOf(s), "SuggestGasPrice", func(_ *backends.SimulatedBackend, _ context.Context) (*big.Int, error) {
+		return big.NewInt(875000000), nil
+	})
+	defer patches.Reset()
+
+	pool := NewAccountPool(builders)
+	bgCtx := context.Background()
+	pool.refreshBalances(bgCtx)
+	if pool.Sender() != builders[0].Sender() {
+		t.Errorf("expected the first account as primary sender")
+	}
+
+	toAddress := common.HexToAddress("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B")
+	wantSenders := []common.Address{builders[0].Sender(), builders[2].Sender(), builders[0].Sender()}
+	for i, want := range wantSenders {
+		txHash, err := pool.Transfer(bgCtx, toAddress.Hex(), big.NewInt(1000))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx, _, err := simClient.TransactionByHash(bgCtx, txHash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sender, _ := types.Sender(builders[0].signer, tx)
+		if sender != want {
+			t.Errorf("transfer %d sent from %v, want %v", i, sender, want)
+		}
+		if _, ok := pool.Status(txHash); !ok {
+			t.Errorf("expected status of transfer %d to be tracked", i)
+		}
+	}
+
+	if _, err := pool.Transfer(bgCtx, toAddress.Hex(), big.NewInt(10000000000000000)); err != ErrNoAccount {
+		t.Errorf("expected no account to cover the payout, got %v", err)
+	}
+}
+
+func TestAccountPoolRotatesOnInsufficientFunds(t *testing.T) {
+	builders := []*TxBuild{{}, {}}
+	pool := NewAccountPool(builders)
+	for _, b := range builders {
+		b.tracker = NewTracker(nil, time.Second)
+	}
+
+	var used []*TxBuild
+	send := func(b *TxBuild) (common.Hash, error) {
+		used = append(used, b)
+		if b == builders[0] {
+			return common.Hash{}, errors.New("insufficient funds for gas * price + value")
+		}
+		return common.HexToHash("0x01"), nil
+	}
+	if _, err := pool.withAccount(big.NewInt(1), reserveTransferGas, send); err != nil {
+		t.Fatal(err)
+	}
+	if len(used) != 2 || used[1] != builders[1] {
+		t.Fatalf("expected the pool to rotate to the second account, used %d accounts", len(used))
+	}
+	if pool.balances[0].Sign() != 0 {
+		t.Error("expected the exhausted account to be skipped until its balance is refreshed")
+	}
+
+	used = nil
+	if _, err := pool.withAccount(big.NewInt(1), reserveTransferGas, send); err != nil || len(used) != 1 || used[0] != builders[1] {
+		t.Errorf("expected the exhausted account to be skipped, err %v", err)
+	}
+
+	failing := errors.New("connection refused")
+	if _, err := pool.withAccount(big.NewInt(1), reserveTransferGas, func(*TxBuild) (common.Hash, error) {
+		return common.Hash{}, failing
+	}); err != failing {
+		t.Errorf("expected other errors to be returned without rotating, got %v", err)
+	}
+}
+
+func TestAccountPoolReservesGas(t *testing.T) {
+	builders := []*TxBuild{{}, {}}
+	pool := NewAccountPool(builders)
+	for _, b := range builders {
+		b.tracker = NewTracker(nil, time.Second)
+	}
+	// The first account only holds dust, the second can pay for the gas
+	pool.balances = []*big.Int{big.NewInt(1), big.NewInt(1000000000000000)}
+	pool.gasPrice = big.NewInt(1000000000)
+
+	var used *TxBuild
+	send := func(b *TxBuild) (common.Hash, error) {
+		used = b
+		return common.HexToHash("0x01"), nil
+	}
+	if _, err := pool.withAccount(new(big.Int), reserveTokenGas, send); err != nil {
+		t.Fatal(err)
+	}
+	if used != builders[1] {
+		t.Error("expected the dusted account to be skipped for a token payout")
+	}
+
+	if _, err := pool.withAccount(big.NewInt(980000000000000), reserveTransferGas, send); err != ErrNoAccount {
+		t.Errorf("expected the value and gas reserve to exceed the balance, got %v", err)
+	}
+}
@@ -0,0 +1,247 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	log "github.com/sirupsen/logrus"
+)
+
+type TxState string
+
+const (
+	TxPending TxState = "pending"
+	TxMined   TxState = "mined"
+	TxFailed  TxState = "failed"
+)
+
+const (
+	// dropTimeout is how long a transaction may be unknown to the node
+	// before it is considered dropped from the mempool.
+	dropTimeout = 5 * time.Minute
+	// trackRetention is how long finished transactions are remembered.
+	trackRetention = 24 * time.Hour
+)
+
+type TxStatus struct {
+	Hash          common.Hash
+	State         TxState
+	BlockNumber   uint64
+	Confirmations uint64
+	Reason        string
+}
+
+type receiptBackend interface {
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+	TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
+	TransactionByHash(ctx context.Context, txHash common.Hash) (*types.Transaction, bool, error)
+}
+
+// trackedTx follows one nonce of the sender. Besides the original transaction
+// it holds every replacement broadcast for the same nonce, since any of them
+// may end up being mined.
+type trackedTx struct {
+	txs         []*types.Transaction
+	sentAt      time.Time
+	state       TxState
+	hash        common.Hash
+	blockNumber uint64
+	reason      string
+	finishedAt  time.Time
+}
+
+func (e *trackedTx) latest() *types.Transaction {
+	return e.txs[len(e.txs)-1]
+}
+
+// Tracker polls the receipts of sent transactions to report whether they
+// were mined, reverted or dropped.
+type Tracker struct {
+	mu       sync.RWMutex
+	client   receiptBackend
+	interval time.Duration
+	head     uint64
+	txs      map[common.Hash]*trackedTx
+}
+
+func NewTracker(client receiptBackend, interval time.Duration) *Tracker {
+	return &Tracker{
+		client:   client,
+		interval: interval,
+		txs:      make(map[common.Hash]*trackedTx),
+	}
+}
+
+func (t *Tracker) Track(tx *types.Transaction) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.txs[tx.Hash()] = &trackedTx{
+		txs:    []*types.Transaction{tx},
+		sentAt: time.Now(),
+		state:  TxPending,
+		hash:   tx.Hash(),
+	}
+}
+
+// Replace records tx as a replacement of the pending transaction old.
+// Statuses queried by any hash of the entry then follow the replacement.
+func (t *Tracker) Replace(old common.Hash, tx *types.Transaction) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry, ok := t.txs[old]
+	if !ok {
+		return
+	}
+	entry.txs = append(entry.txs, tx)
+	entry.sentAt = time.Now()
+	if entry.state == TxPending {
+		entry.hash = tx.Hash()
+	}
+	t.txs[tx.Hash()] = entry
+}
+
+// Stuck returns the latest transaction of every entry that has been pending
+// for longer than age since it was last broadcast.
+func (t *Tracker) Stuck(age time.Duration) []*types.Transaction {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	var stuck []*types.Transaction
+	for hash, entry := range t.txs {
+		if entry.state == TxPending && hash == entry.hash && time.Since(entry.sentAt) > age {
+			stuck = append(stuck, entry.latest())
+		}
+	}
+	return stuck
+}
+
+func (t *Tracker) Status(hash common.Hash) (*TxStatus, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	entry, ok := t.txs[hash]
+	if !ok {
+		return nil, false
+	}
+
+	status := &TxStatus{
+		Hash:        entry.hash,
+		State:       entry.state,
+		BlockNumber: entry.blockNumber,
+		Reason:      entry.reason,
+	}
+	if entry.blockNumber > 0 && t.head >= entry.blockNumber {
+		status.Confirmations = t.head - entry.blockNumber + 1
+	}
+	return status, true
+}
+
+func (t *Tracker) Run(ctx context.Context) {
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			t.poll(ctx)
+		}
+	}
+}
+
+func (t *Tracker) poll(ctx context.Context) {
+	if header, err := t.client.HeaderByNumber(ctx, nil); err != nil {
+		log.WithError(err).Warn("Failed to fetch latest block header")
+	} else {
+		t.mu.Lock()
+		t.head = header.Number.Uint64()
+		t.mu.Unlock()
+	}
+
+	for _, entry := range t.pending() {
+		t.refresh(ctx, entry)
+	}
+	t.prune()
+}
+
+func (t *Tracker) pending() []*trackedTx {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	var entries []*trackedTx
+	for hash, entry := range t.txs {
+		if entry.state == TxPending && hash == entry.hash {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+func (t *Tracker) refresh(ctx context.Context, entry *trackedTx) {
+	t.mu.RLock()
+	txs := append([]*types.Transaction(nil), entry.txs...)
+	sentAt := entry.sentAt
+	t.mu.RUnlock()
+
+	for i := len(txs) - 1; i >= 0; i-- {
+		hash := txs[i].Hash()
+		receipt, err := t.client.TransactionReceipt(ctx, hash)
+		if err == nil && receipt != nil {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			entry.hash = hash
+			entry.blockNumber = receipt.BlockNumber.Uint64()
+			if entry.blockNumber > t.head {
+				t.head = entry.blockNumber
+			}
+			entry.finishedAt = time.Now()
+			if receipt.Status == types.ReceiptStatusSuccessful {
+				entry.state = TxMined
+			} else {
+				entry.state = TxFailed
+				entry.reason = "transaction reverted"
+			}
+			return
+		}
+		if err != nil && !errors.Is(err, ethereum.NotFound) {
+			log.WithFields(log.Fields{
+				"txHash": hash,
+				"error":  err,
+			}).Warn("Failed to fetch transaction receipt")
+			return
+		}
+	}
+
+	if time.Since(sentAt) < dropTimeout {
+		return
+	}
+	for _, tx := range txs {
+		if _, _, err := t.client.TransactionByHash(ctx, tx.Hash()); !errors.Is(err, ethereum.NotFound) {
+			return
+		}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	entry.state = TxFailed
+	entry.reason = "transaction dropped from mempool"
+	entry.finishedAt = time.Now()
+}
+
+func (t *Tracker) prune() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for hash, entry := range t.txs {
+		if entry.state != TxPending && time.Since(entry.finishedAt) > trackRetention {
+			delete(t.txs, hash)
+		}
+	}
+}
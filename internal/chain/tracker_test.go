@@ -0,0 +1,76 @@
+package chain
+
+import (
+	"context"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/agiledragon/gomonkey/v2"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestTracker(t *testing.T) {
+	privateKey, _ := crypto.HexToECDSA("976f9f7772781ff6d1c93941129d417c49a209c674056a3cf5e27e225ee55fa8")
+	fromAddress := crypto.PubkeyToAddress(privateKey.PublicKey)
+	// PUSH1 0 PUSH1 0 REVERT
+	revertingAddress := common.HexToAddress("0x000000000000000000000000000000000000dEaD")
+	simClient := backends.NewSimulatedBackend(
+		core.GenesisAlloc{
+			fromAddress:      {Balance: big.NewInt(10000000000000000)},
+			revertingAddress: {Balance: big.NewInt(0), Code: common.FromHex("0x60006000fd")},
+		}, 10000000,
+	)
+	defer simClient.Close()
+	var s *backends.SimulatedBackend
+	patches := gomonkey.ApplyMethod(reflect.TypeOf(s), "SuggestGasPrice", func(_ *backends.SimulatedBackend, _ context.Context) (*big.Int, error) {
+		return big.NewInt(875000000), nil
+	})
+	defer patches.Reset()
+
+	tracker := NewTracker(simClient, time.Second)
+	txBuilder := &TxBuild{
+		client:          simClient,
+		privateKey:      privateKey,
+		signer:          types.NewLondonSigner(big.NewInt(1337)),
+		fromAddress:     fromAddress,
+		supportsEIP1559: false,
+		tracker:         tracker,
+	}
+	bgCtx := context.Background()
+	toAddress := common.HexToAddress("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B")
+	minedHash, err := txBuilder.Transfer(bgCtx, toAddress.Hex(), big.NewInt(1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	revertedHash, err := txBuilder.send(bgCtx, &revertingAddress, big.NewInt(0), nil, 50000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tracker.poll(bgCtx)
+	if status, ok := txBuilder.Status(minedHash); !ok || status.State != TxPending {
+		t.Fatalf("expected pending status before commit, got %+v", status)
+	}
+	if _, ok := txBuilder.Status(common.Hash{1}); ok {
+		t.Error("expected unknown transaction to have no status")
+	}
+
+	simClient.Commit()
+	simClient.Commit()
+	tracker.poll(bgCtx)
+
+	status, _ := txBuilder.Status(minedHash)
+	if status.State != TxMined || status.BlockNumber != 1 || status.Confirmations != 2 {
+		t.Errorf("unexpected status of mined transaction: %+v", status)
+	}
+	status, _ = txBuilder.Status(revertedHash)
+	if status.State != TxFailed || status.Reason == "" {
+		t.Errorf("unexpected status of reverted transaction: %+v", status)
+	}
+}
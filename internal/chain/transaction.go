@@ -7,38 +7,62 @@ import (
 	"math/big"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
 	log "github.com/sirupsen/logrus"
+
+	"github.com/chainflag/eth-faucet/internal/metrics"
 )
 
+const trackerInterval = 5 * time.Second
+
 type TxBuilder interface {
 	Sender() common.Address
 	Transfer(ctx context.Context, to string, value *big.Int) (common.Hash, error)
+	TransferToken(ctx context.Context, token common.Address, to string, value *big.Int) (common.Hash, error)
+	Balance(ctx context.Context) (*big.Int, error)
+	TokenBalance(ctx context.Context, token common.Address) (*big.Int, error)
+	Disperse(ctx context.Context, contract common.Address, recipients []common.Address, values []*big.Int) (common.Hash, error)
+	Status(hash common.Hash) (*TxStatus, bool)
+	RefreshNonce(ctx context.Context) error
+}
+
+// Backend is the node connection used to build, send and track transactions.
+type Backend interface {
+	bind.ContractBackend
+	receiptBackend
+	BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error)
 }
 
 type TxBuild struct {
 	mu              sync.Mutex
-	client          bind.ContractTransactor
+	client          Backend
 	privateKey      *ecdsa.PrivateKey
 	signer          types.Signer
 	fromAddress     common.Address
 	nonce           uint64
 	supportsEIP1559 bool
+	tracker         *Tracker
+	policy          ReplacePolicy
 }
 
-func NewTxBuilder(provider string, privateKey *ecdsa.PrivateKey, chainID *big.Int) (TxBuilder, error) {
-	client, err := ethclient.Dial(provider)
-	if err != nil {
-		return nil, err
+// NewTxBuilder returns a builder sending through client, funded by the given
+// keys. With more than one key, claims are rotated across the accounts. The
+// builder tracks its transactions and balances until ctx is done.
+func NewTxBuilder(ctx context.Context, client *ethclient.Client, privateKeys []*ecdsa.PrivateKey, chainID *big.Int, policy ReplacePolicy) (TxBuilder, error) {
+	if len(privateKeys) == 0 {
+		return nil, fmt.Errorf("no private keys to fund user requests with")
 	}
 
+	var err error
 	if chainID == nil {
-		chainID, err = client.ChainID(context.Background())
+		chainID, err = client.ChainID(ctx)
 		if err != nil {
 			return nil, err
 		}
@@ -49,16 +73,36 @@ func NewTxBuilder(provider string, privateKey *ecdsa.PrivateKey, chainID *big.In
 		return nil, err
 	}
 
+	builders := make([]*TxBuild, len(privateKeys))
+	for i, privateKey := range privateKeys {
+		builders[i] = newTxBuild(ctx, client, privateKey, chainID, supportsEIP1559, policy)
+	}
+	if len(builders) == 1 {
+		return builders[0], nil
+	}
+
+	pool := NewAccountPool(builders)
+	go pool.Run(ctx)
+	return pool, nil
+}
+
+func newTxBuild(ctx context.Context, client Backend, privateKey *ecdsa.PrivateKey, chainID *big.Int, supportsEIP1559 bool, policy ReplacePolicy) *TxBuild {
 	txBuilder := &TxBuild{
 		client:          client,
 		privateKey:      privateKey,
 		signer:          types.NewLondonSigner(chainID),
 		fromAddress:     crypto.PubkeyToAddress(privateKey.PublicKey),
 		supportsEIP1559: supportsEIP1559,
+		tracker:         NewTracker(client, trackerInterval),
+		policy:          policy,
+	}
+	txBuilder.refreshNonce(ctx)
+	go txBuilder.tracker.Run(ctx)
+	if policy.After > 0 {
+		go txBuilder.watchStuck(ctx)
 	}
-	txBuilder.refreshNonce(context.Background())
 
-	return txBuilder, nil
+	return txBuilder
 }
 
 func (b *TxBuild) Sender() common.Address {
@@ -70,20 +114,100 @@ func (b *TxBuild) Transfer(ctx context.Context, to string, value *big.Int) (comm
 		return common.Hash{}, fmt.Errorf("invalid transfer value: must be positive")
 	}
 
+	toAddress := common.HexToAddress(to)
+	return b.send(ctx, &toAddress, value, nil, 21000)
+}
+
+func (b *TxBuild) TransferToken(ctx context.Context, token common.Address, to string, value *big.Int) (common.Hash, error) {
+	if value == nil || value.Sign() <= 0 {
+		return common.Hash{}, fmt.Errorf("invalid transfer value: must be positive")
+	}
+
+	data, err := erc20.Pack("transfer", common.HexToAddress(to), value)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	gasLimit, err := b.client.EstimateGas(ctx, ethereum.CallMsg{
+		From: b.fromAddress,
+		To:   &token,
+		Data: data,
+	})
+	if err = countRPCError("eth_estimateGas", err); err != nil {
+		return common.Hash{}, fmt.Errorf("failed to estimate gas: %w", err)
+	}
+
+	return b.send(ctx, &token, big.NewInt(0), data, gasLimit)
+}
+
+func (b *TxBuild) Balance(ctx context.Context) (*big.Int, error) {
+	balance, err := b.client.BalanceAt(ctx, b.fromAddress, nil)
+	return balance, countRPCError("eth_getBalance", err)
+}
+
+func (b *TxBuild) TokenBalance(ctx context.Context, token common.Address) (*big.Int, error) {
+	data, err := erc20.Pack("balanceOf", b.fromAddress)
+	if err != nil {
+		return nil, err
+	}
+	output, err := b.client.CallContract(ctx, ethereum.CallMsg{To: &token, Data: data}, nil)
+	if err = countRPCError("eth_call", err); err != nil {
+		return nil, err
+	}
+
+	results, err := erc20.Unpack("balanceOf", output)
+	if err != nil {
+		return nil, err
+	}
+	return results[0].(*big.Int), nil
+}
+
+// Disperse pays all recipients in a single call to a disperse-style contract.
+func (b *TxBuild) Disperse(ctx context.Context, contract common.Address, recipients []common.Address, values []*big.Int) (common.Hash, error) {
+	if len(recipients) == 0 || len(recipients) != len(values) {
+		return common.Hash{}, fmt.Errorf("invalid disperse: %d recipients with %d values", len(recipients), len(values))
+	}
+	total := new(big.Int)
+	for _, value := range values {
+		if value == nil || value.Sign() <= 0 {
+			return common.Hash{}, fmt.Errorf("invalid transfer value: must be positive")
+		}
+		total.Add(total, value)
+	}
+
+	data, err := disperse.Pack("disperseEther", recipients, values)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	gasLimit, err := b.client.EstimateGas(ctx, ethereum.CallMsg{
+		From:  b.fromAddress,
+		To:    &contract,
+		Value: total,
+		Data:  data,
+	})
+	if err = countRPCError("eth_estimateGas", err); err != nil {
+		return common.Hash{}, fmt.Errorf("failed to estimate gas: %w", err)
+	}
+
+	return b.send(ctx, &contract, total, data, gasLimit)
+}
+
+func (b *TxBuild) send(ctx context.Context, to *common.Address, value *big.Int, data []byte, gasLimit uint64) (common.Hash, error) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
+	start := time.Now()
+	defer func() {
+		metrics.TxSendDuration.Observe(time.Since(start).Seconds())
+	}()
 
-	gasLimit := uint64(21000)
-	toAddress := common.HexToAddress(to)
 	nonce := b.nonce
 
 	var err error
 	var unsignedTx *types.Transaction
 
 	if b.supportsEIP1559 {
-		unsignedTx, err = b.buildEIP1559Tx(ctx, &toAddress, value, gasLimit, nonce)
+		unsignedTx, err = b.buildEIP1559Tx(ctx, to, value, data, gasLimit, nonce)
 	} else {
-		unsignedTx, err = b.buildLegacyTx(ctx, &toAddress, value, gasLimit, nonce)
+		unsignedTx, err = b.buildLegacyTx(ctx, to, value, data, gasLimit, nonce)
 	}
 
 	if err != nil {
@@ -95,7 +219,7 @@ func (b *TxBuild) Transfer(ctx context.Context, to string, value *big.Int) (comm
 		return common.Hash{}, err
 	}
 
-	if err = b.client.SendTransaction(ctx, signedTx); err != nil {
+	if err = countRPCError("eth_sendRawTransaction", b.client.SendTransaction(ctx, signedTx)); err != nil {
 		if strings.Contains(strings.ToLower(err.Error()), "nonce") {
 			b.refreshNonce(ctx)
 		}
@@ -103,17 +227,23 @@ func (b *TxBuild) Transfer(ctx context.Context, to string, value *big.Int) (comm
 	}
 
 	b.nonce++
+	metrics.Nonce.WithLabelValues(b.fromAddress.Hex()).Set(float64(b.nonce))
+	b.tracker.Track(signedTx)
 	return signedTx.Hash(), nil
 }
 
-func (b *TxBuild) buildEIP1559Tx(ctx context.Context, to *common.Address, value *big.Int, gasLimit uint64, nonce uint64) (*types.Transaction, error) {
+func (b *TxBuild) Status(hash common.Hash) (*TxStatus, bool) {
+	return b.tracker.Status(hash)
+}
+
+func (b *TxBuild) buildEIP1559Tx(ctx context.Context, to *common.Address, value *big.Int, data []byte, gasLimit uint64, nonce uint64) (*types.Transaction, error) {
 	header, err := b.client.HeaderByNumber(ctx, nil)
-	if err != nil {
+	if err = countRPCError("eth_getBlockByNumber", err); err != nil {
 		return nil, err
 	}
 
 	gasTipCap, err := b.client.SuggestGasTipCap(ctx)
-	if err != nil {
+	if err = countRPCError("eth_maxPriorityFeePerGas", err); err != nil {
 		return nil, err
 	}
 
@@ -129,12 +259,13 @@ func (b *TxBuild) buildEIP1559Tx(ctx context.Context, to *common.Address, value
 		Gas:       gasLimit,
 		To:        to,
 		Value:     value,
+		Data:      data,
 	}), nil
 }
 
-func (b *TxBuild) buildLegacyTx(ctx context.Context, to *common.Address, value *big.Int, gasLimit uint64, nonce uint64) (*types.Transaction, error) {
+func (b *TxBuild) buildLegacyTx(ctx context.Context, to *common.Address, value *big.Int, data []byte, gasLimit uint64, nonce uint64) (*types.Transaction, error) {
 	gasPrice, err := b.client.SuggestGasPrice(ctx)
-	if err != nil {
+	if err = countRPCError("eth_gasPrice", err); err != nil {
 		return nil, err
 	}
 
@@ -144,21 +275,41 @@ func (b *TxBuild) buildLegacyTx(ctx context.Context, to *common.Address, value *
 		Gas:      gasLimit,
 		To:       to,
 		Value:    value,
+		Data:     data,
 	}), nil
 }
 
-func (b *TxBuild) refreshNonce(ctx context.Context) {
+// RefreshNonce resynchronizes the next nonce with the pending nonce reported
+// by the node, once the transaction being sent, if any, has gone out.
+func (b *TxBuild) RefreshNonce(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.refreshNonce(ctx)
+}
+
+func (b *TxBuild) refreshNonce(ctx context.Context) error {
 	nonce, err := b.client.PendingNonceAt(ctx, b.Sender())
-	if err != nil {
+	if err = countRPCError("eth_getTransactionCount", err); err != nil {
 		log.WithFields(log.Fields{
 			"address": b.Sender(),
 			"error":   err,
 		}).Error("failed to refresh account nonce")
-		return
+		return err
 	}
 
 	b.nonce = nonce
+	metrics.Nonce.WithLabelValues(b.fromAddress.Hex()).Set(float64(nonce))
 	log.WithField("nonce", nonce).Info("Nonce refreshed successfully")
+	return nil
+}
+
+// countRPCError records a failed call to the node under its JSON-RPC method
+// and returns err unchanged.
+func countRPCError(method string, err error) error {
+	if err != nil {
+		metrics.RPCErrors.WithLabelValues(method).Inc()
+	}
+	return err
 }
 
 func checkEIP1559Support(client *ethclient.Client) (bool, error) {
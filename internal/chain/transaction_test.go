@@ -1,10 +1,12 @@
 package chain
 
 import (
+	"bytes"
 	"context"
 	"math/big"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/agiledragon/gomonkey/v2"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
@@ -35,6 +37,7 @@ func TestTxBuilder(t *testing.T) {
 		signer:          types.NewLondonSigner(big.NewInt(1337)),
 		fromAddress:     crypto.PubkeyToAddress(privateKey.PublicKey),
 		supportsEIP1559: false,
+		tracker:         NewTracker(simClient, time.Second),
 	}
 	bgCtx := context.Background()
 	toAddress := common.HexToAddress("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B")
@@ -61,3 +64,56 @@ func TestTxBuilder(t *testing.T) {
 		t.Errorf("expected balance for to address not received. expected: %v actual: %v", value, bal)
 	}
 }
+
+func TestTxBuilderTransferToken(t *testing.T) {
+	privateKey, _ := crypto.HexToECDSA("976f9f7772781ff6d1c93941129d417c49a209c674056a3cf5e27e225ee55fa8")
+	fromAddress := crypto.PubkeyToAddress(privateKey.PublicKey)
+	simClient := backends.NewSimulatedBackend(
+		core.GenesisAlloc{
+			fromAddress: {Balance: big.NewInt(10000000000000000)},
+		}, 10000000,
+	)
+	defer simClient.Close()
+	var s *backends.SimulatedBackend
+	patches := gomonkey.ApplyMethod(reflect.TypeOf(s), "SuggestGasPrice", func(_ *backends.SimulatedBackend, _ context.Context) (*big.Int, error) {
+		return big.NewInt(875000000), nil
+	})
+	defer patches.Reset()
+
+	txBuilder := &TxBuild{
+		client:          simClient,
+		privateKey:      privateKey,
+		signer:          types.NewLondonSigner(big.NewInt(1337)),
+		fromAddress:     fromAddress,
+		supportsEIP1559: false,
+		tracker:         NewTracker(simClient, time.Second),
+	}
+	bgCtx := context.Background()
+	tokenAddress := common.HexToAddress("0x6B175474E89094C44Da98b954EedeAC495271d0F")
+	toAddress := common.HexToAddress("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B")
+	value := big.NewInt(1000)
+	txHash, err := txBuilder.TransferToken(bgCtx, tokenAddress, toAddress.Hex(), value)
+	if err != nil {
+		t.Fatalf("could not add tx to pending block: %v", err)
+	}
+	simClient.Commit()
+
+	block, err := simClient.BlockByNumber(bgCtx, big.NewInt(1))
+	if err != nil {
+		t.Fatalf("could not get block at height 1: %v", err)
+	}
+	tx := block.Transactions()[0]
+	if txHash != tx.Hash() {
+		t.Errorf("did not commit sent transaction. expected hash %v got hash %v", tx.Hash(), txHash)
+	}
+	if *tx.To() != tokenAddress {
+		t.Errorf("expected transaction to token contract %v got %v", tokenAddress, tx.To())
+	}
+	if tx.Value().Sign() != 0 {
+		t.Errorf("expected zero value token transfer got %v", tx.Value())
+	}
+	data, _ := erc20.Pack("transfer", toAddress, value)
+	if !bytes.Equal(tx.Data(), data) {
+		t.Errorf("unexpected calldata %x", tx.Data())
+	}
+}
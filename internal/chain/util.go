@@ -8,17 +8,21 @@ import (
 )
 
 func EtherToWei(amount float64) *big.Int {
+	return ToBaseUnits(amount, 18)
+}
+
+// ToBaseUnits converts a human readable token amount into its smallest unit
+// according to the given number of decimals, truncating any excess precision.
+func ToBaseUnits(amount float64, decimals uint8) *big.Int {
 	if amount < 0 {
 		return big.NewInt(0)
 	}
-	oneEther := decimal.NewFromFloat(1e18)
-	result := decimal.NewFromFloat(amount).Mul(oneEther)
-	wei, ok := new(big.Int).SetString(result.String(), 10)
-	if !ok {
-		// Return 0 if conversion fails
-		return big.NewInt(0)
-	}
-	return wei
+	return decimal.NewFromFloat(amount).Shift(int32(decimals)).BigInt()
+}
+
+// FromBaseUnits formats an amount in the token's smallest unit as a decimal string.
+func FromBaseUnits(value *big.Int, decimals uint8) string {
+	return decimal.NewFromBigInt(value, -int32(decimals)).String()
 }
 
 func Has0xPrefix(str string) bool {
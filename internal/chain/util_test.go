@@ -50,3 +50,45 @@ func TestEtherToWei(t *testing.T) {
 		})
 	}
 }
+
+func TestToBaseUnits(t *testing.T) {
+	tests := []struct {
+		name     string
+		amount   float64
+		decimals uint8
+		want     *big.Int
+	}{
+		{name: "6 decimals", amount: 10, decimals: 6, want: big.NewInt(10000000)},
+		{name: "fractional", amount: 2.5, decimals: 6, want: big.NewInt(2500000)},
+		{name: "excess precision", amount: 0.1234567, decimals: 6, want: big.NewInt(123456)},
+		{name: "no decimals", amount: 42, decimals: 0, want: big.NewInt(42)},
+		{name: "negative", amount: -1, decimals: 18, want: big.NewInt(0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ToBaseUnits(tt.amount, tt.decimals); got.Cmp(tt.want) != 0 {
+				t.Errorf("ToBaseUnits() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFromBaseUnits(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    *big.Int
+		decimals uint8
+		want     string
+	}{
+		{name: "6 decimals", value: big.NewInt(2500000), decimals: 6, want: "2.5"},
+		{name: "18 decimals", value: EtherToWei(1), decimals: 18, want: "1"},
+		{name: "zero", value: big.NewInt(0), decimals: 18, want: "0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FromBaseUnits(tt.value, tt.decimals); got != tt.want {
+				t.Errorf("FromBaseUnits() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// feeBumpPercent is the minimum fee increase of a replacement transaction.
+// Geth requires 10% by default, a little headroom keeps other clients happy.
+const feeBumpPercent = 12
+
+var errFeeCeiling = errors.New("replacement fee exceeds the configured ceiling")
+
+// ReplacePolicy controls how transactions stuck in the mempool are replaced.
+type ReplacePolicy struct {
+	// After is how long a transaction may stay pending before it is
+	// rebroadcast with bumped fees. Zero disables replacement.
+	After time.Duration
+	// MaxFee caps the fee cap, or gas price on legacy chains, of
+	// replacement transactions. Nil means no ceiling.
+	MaxFee *big.Int
+}
+
+func (b *TxBuild) watchStuck(ctx context.Context) {
+	ticker := time.NewTicker(trackerInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, tx := range b.tracker.Stuck(b.policy.After) {
+				b.replaceStuck(ctx, tx)
+			}
+		}
+	}
+}
+
+func (b *TxBuild) replaceStuck(ctx context.Context, tx *types.Transaction) {
+	logger := log.WithFields(log.Fields{
+		"txHash": tx.Hash(),
+		"nonce":  tx.Nonce(),
+	})
+	replacement, err := b.replace(ctx, tx)
+	if err != nil {
+		logger.WithError(err).Warn("Failed to replace stuck transaction")
+		return
+	}
+
+	b.tracker.Replace(tx.Hash(), replacement)
+	logger.WithField("replacement", replacement.Hash()).Info("Replaced stuck transaction with bumped fees")
+}
+
+// replace rebroadcasts tx with the same nonce and bumped fees, using the
+// current network fees instead when they are higher.
+func (b *TxBuild) replace(ctx context.Context, tx *types.Transaction) (*types.Transaction, error) {
+	var unsignedTx *types.Transaction
+	if tx.Type() == types.DynamicFeeTxType {
+		suggested, err := b.buildEIP1559Tx(ctx, tx.To(), tx.Value(), tx.Data(), tx.Gas(), tx.Nonce())
+		if err != nil {
+			return nil, err
+		}
+		gasTipCap := maxBig(bumpFee(tx.GasTipCap()), suggested.GasTipCap())
+		gasFeeCap := maxBig(bumpFee(tx.GasFeeCap()), suggested.GasFeeCap())
+		if b.policy.MaxFee != nil && gasFeeCap.Cmp(b.policy.MaxFee) > 0 {
+			return nil, errFeeCeiling
+		}
+		if gasTipCap.Cmp(gasFeeCap) > 0 {
+			gasTipCap = gasFeeCap
+		}
+		unsignedTx = types.NewTx(&types.DynamicFeeTx{
+			ChainID:   b.signer.ChainID(),
+			Nonce:     tx.Nonce(),
+			GasTipCap: gasTipCap,
+			GasFeeCap: gasFeeCap,
+			Gas:       tx.Gas(),
+			To:        tx.To(),
+			Value:     tx.Value(),
+			Data:      tx.Data(),
+		})
+	} else {
+		suggested, err := b.buildLegacyTx(ctx, tx.To(), tx.Value(), tx.Data(), tx.Gas(), tx.Nonce())
+		if err != nil {
+			return nil, err
+		}
+		gasPrice := maxBig(bumpFee(tx.GasPrice()), suggested.GasPrice())
+		if b.policy.MaxFee != nil && gasPrice.Cmp(b.policy.MaxFee) > 0 {
+			return nil, errFeeCeiling
+		}
+		unsignedTx = types.NewTx(&types.LegacyTx{
+			Nonce:    tx.Nonce(),
+			GasPrice: gasPrice,
+			Gas:      tx.Gas(),
+			To:       tx.To(),
+			Value:    tx.Value(),
+			Data:     tx.Data(),
+		})
+	}
+
+	signedTx, err := types.SignTx(unsignedTx, b.signer, b.privateKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := countRPCError("eth_sendRawTransaction", b.client.SendTransaction(ctx, signedTx)); err != nil {
+		return nil, err
+	}
+	return signedTx, nil
+}
+
+// bumpFee raises fee by feeBumpPercent, rounding up so small fees still grow.
+func bumpFee(fee *big.Int) *big.Int {
+	bumped := new(big.Int).Mul(fee, big.NewInt(100+feeBumpPercent))
+	bumped.Add(bumped, big.NewInt(99))
+	return bumped.Div(bumped, big.NewInt(100))
+}
+
+func maxBig(x, y *big.Int) *big.Int {
+	if x.Cmp(y) >= 0 {
+		return x
+	}
+	return y
+}
@@ -0,0 +1,102 @@
+package chain
+
+import (
+	"context"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/agiledragon/gomonkey/v2"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestBumpFee(t *testing.T) {
+	tests := []struct {
+		name string
+		fee  *big.Int
+		want *big.Int
+	}{
+		{name: "gwei", fee: big.NewInt(1000000000), want: big.NewInt(1120000000)},
+		{name: "round up", fee: big.NewInt(1), want: big.NewInt(2)},
+		{name: "zero", fee: big.NewInt(0), want: big.NewInt(0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := bumpFee(tt.fee); got.Cmp(tt.want) != 0 {
+				t.Errorf("bumpFee() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplaceStuck(t *testing.T) {
+	privateKey, _ := crypto.HexToECDSA("976f9f7772781ff6d1c93941129d417c49a209c674056a3cf5e27e225ee55fa8")
+	fromAddress := crypto.PubkeyToAddress(privateKey.PublicKey)
+	simClient := backends.NewSimulatedBackend(
+		core.GenesisAlloc{
+			fromAddress: {Balance: big.NewInt(10000000000000000)},
+		}, 10000000,
+	)
+	defer simClient.Close()
+	var s *backends.SimulatedBackend
+	patches := gomonkey.ApplyMethod(reflect.TypeOf(s), "SuggestGasPrice", func(_ *backends.SimulatedBackend, _ context.Context) (*big.Int, error) {
+		return big.NewInt(875000000), nil
+	})
+	defer patches.Reset()
+
+	tracker := NewTracker(simClient, time.Second)
+	txBuilder := &TxBuild{
+		client:          simClient,
+		privateKey:      privateKey,
+		signer:          types.NewLondonSigner(big.NewInt(1337)),
+		fromAddress:     fromAddress,
+		supportsEIP1559: false,
+		tracker:         tracker,
+		policy:          ReplacePolicy{After: time.Minute, MaxFee: big.NewInt(1000000000)},
+	}
+	bgCtx := context.Background()
+	toAddress := common.HexToAddress("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B")
+	txHash, err := txBuilder.Transfer(bgCtx, toAddress.Hex(), big.NewInt(1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stuck := tracker.Stuck(0)
+	if len(stuck) != 1 || stuck[0].Hash() != txHash {
+		t.Fatalf("expected sent transaction to be reported as stuck, got %v", stuck)
+	}
+	if len(tracker.Stuck(time.Minute)) != 0 {
+		t.Error("expected no stuck transactions younger than the replacement age")
+	}
+
+	// The simulated backend rejects reused nonces, so capture the replacement instead
+	var sent *types.Transaction
+	patches.ApplyMethod(reflect.TypeOf(s), "SendTransaction", func(_ *backends.SimulatedBackend, _ context.Context, tx *types.Transaction) error {
+		sent = tx
+		return nil
+	})
+	txBuilder.replaceStuck(bgCtx, stuck[0])
+	if sent == nil {
+		t.Fatal("expected a replacement transaction to be sent")
+	}
+	if sent.Nonce() != stuck[0].Nonce() || *sent.To() != toAddress || sent.Value().Cmp(big.NewInt(1000)) != 0 {
+		t.Errorf("replacement does not match the stuck transaction: %+v", sent)
+	}
+	if sent.GasPrice().Cmp(big.NewInt(980000000)) != 0 {
+		t.Errorf("expected bumped gas price 980000000, got %v", sent.GasPrice())
+	}
+	status, _ := tracker.Status(txHash)
+	if status.Hash != sent.Hash() || status.State != TxPending {
+		t.Errorf("expected status to follow the replacement, got %+v", status)
+	}
+
+	// A second bump would exceed the 1 gwei ceiling
+	if _, err := txBuilder.replace(bgCtx, sent); err != errFeeCeiling {
+		t.Errorf("expected fee ceiling error, got %v", err)
+	}
+}
@@ -0,0 +1,774 @@
+// Package config defines the faucet settings and loads them from a YAML or
+// TOML file and the environment. Keys mirror the command-line flags, so
+// -faucet.amount is set by the amount key of the faucet section.
+package config
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix is prepended to the upper-cased key path of every setting to
+// form its environment variable, e.g. FAUCET_WALLET_PROVIDER.
+const EnvPrefix = "FAUCET_"
+
+type Config struct {
+	HTTPPort   int `yaml:"httpport" toml:"httpport"`
+	ProxyCount int `yaml:"proxycount" toml:"proxycount"`
+
+	Faucet      FaucetConfig      `yaml:"faucet" toml:"faucet"`
+	Networks    []NetworkConfig   `yaml:"networks" toml:"networks"`
+	Batch       BatchConfig       `yaml:"batch" toml:"batch"`
+	Limiter     LimiterConfig     `yaml:"limiter" toml:"limiter"`
+	History     HistoryConfig     `yaml:"history" toml:"history"`
+	Wallet      WalletConfig      `yaml:"wallet" toml:"wallet"`
+	HCaptcha    HCaptchaConfig    `yaml:"hcaptcha" toml:"hcaptcha"`
+	Captcha     CaptchaConfig     `yaml:"captcha" toml:"captcha"`
+	PoW         PoWConfig         `yaml:"pow" toml:"pow"`
+	Access      AccessConfig      `yaml:"access" toml:"access"`
+	Eligibility EligibilityConfig `yaml:"eligibility" toml:"eligibility"`
+	Auth        AuthConfig        `yaml:"auth" toml:"auth"`
+	Tiers       []TierConfig      `yaml:"tiers" toml:"tiers"`
+	Admin       AdminConfig       `yaml:"admin" toml:"admin"`
+}
+
+type FaucetConfig struct {
+	Name       string        `yaml:"name" toml:"name"`
+	Symbol     string        `yaml:"symbol" toml:"symbol"`
+	Amount     float64       `yaml:"amount" toml:"amount"`
+	Minutes    int           `yaml:"minutes" toml:"minutes"`
+	MinBalance float64       `yaml:"minbalance" toml:"minbalance"`
+	LowBalance float64       `yaml:"lowbalance" toml:"lowbalance"`
+	Tokens     []TokenConfig `yaml:"tokens" toml:"tokens"`
+	// HourlyBudget and DailyBudget cap the Ethers paid out by each network
+	// per hour and per UTC day, across all claimants
+	HourlyBudget float64 `yaml:"hourlybudget" toml:"hourlybudget"`
+	DailyBudget  float64 `yaml:"dailybudget" toml:"dailybudget"`
+}
+
+type TokenConfig struct {
+	Symbol   string  `yaml:"symbol" toml:"symbol"`
+	Address  string  `yaml:"address" toml:"address"`
+	Decimals uint8   `yaml:"decimals" toml:"decimals"`
+	Amount   float64 `yaml:"amount" toml:"amount"`
+}
+
+// NetworkConfig describes one of several chains served by the faucet. Unset
+// fields fall back to the faucet and wallet sections, except for tokens,
+// whose addresses differ from chain to chain.
+type NetworkConfig struct {
+	// Name identifies the network in routes such as /api/{name}/claim
+	Name string `yaml:"name" toml:"name"`
+	// ChainID is detected from the provider when zero
+	ChainID  int64         `yaml:"chainid" toml:"chainid"`
+	Provider string        `yaml:"provider" toml:"provider"`
+	Symbol   string        `yaml:"symbol" toml:"symbol"`
+	Amount   float64       `yaml:"amount" toml:"amount"`
+	Minutes  *int          `yaml:"minutes" toml:"minutes"`
+	Tokens   []TokenConfig `yaml:"tokens" toml:"tokens"`
+}
+
+type BatchConfig struct {
+	Contract string        `yaml:"contract" toml:"contract"`
+	Window   time.Duration `yaml:"window" toml:"window"`
+	Size     int           `yaml:"size" toml:"size"`
+}
+
+type LimiterConfig struct {
+	Backend string `yaml:"backend" toml:"backend"`
+	Path    string `yaml:"path" toml:"path"`
+	Redis   string `yaml:"redis" toml:"redis"`
+}
+
+// HistoryConfig enables the claim history, a record of every claim attempt
+// kept in a BoltDB file at Path. Records older than Retention are deleted,
+// or never if it is zero.
+type HistoryConfig struct {
+	Path      string        `yaml:"path" toml:"path"`
+	Retention time.Duration `yaml:"retention" toml:"retention"`
+}
+
+type WalletConfig struct {
+	Provider     string        `yaml:"provider" toml:"provider"`
+	PrivKeys     []string      `yaml:"privkeys" toml:"privkeys"`
+	KeyJSON      string        `yaml:"keyjson" toml:"keyjson"`
+	KeyPass      string        `yaml:"keypass" toml:"keypass"`
+	ReplaceAfter time.Duration `yaml:"replaceafter" toml:"replaceafter"`
+	MaxFee       float64       `yaml:"maxfee" toml:"maxfee"`
+}
+
+type HCaptchaConfig struct {
+	SiteKey string `yaml:"sitekey" toml:"sitekey"`
+	Secret  string `yaml:"secret" toml:"secret"`
+}
+
+// CaptchaConfig selects the captcha protecting claims. It supersedes the
+// hcaptcha section, which remains as a shorthand for the hcaptcha provider.
+type CaptchaConfig struct {
+	// Provider is one of hcaptcha, recaptcha, recaptcha-v3 or turnstile
+	Provider string `yaml:"provider" toml:"provider"`
+	SiteKey  string `yaml:"sitekey" toml:"sitekey"`
+	Secret   string `yaml:"secret" toml:"secret"`
+	// VerifyURL overrides the verification endpoint of the provider
+	VerifyURL string `yaml:"verifyurl" toml:"verifyurl"`
+	// MinScore is the lowest reCAPTCHA v3 score accepted
+	MinScore float64 `yaml:"minscore" toml:"minscore"`
+}
+
+// CaptchaProviders lists the supported captcha providers.
+var CaptchaProviders = []string{"hcaptcha", "recaptcha", "recaptcha-v3", "turnstile"}
+
+// ResolvedCaptcha returns the captcha settings, taking those of the hcaptcha
+// section if no provider is configured. Secret is empty if captchas are off.
+func (c *Config) ResolvedCaptcha() CaptchaConfig {
+	if c.Captcha.Provider == "" && c.HCaptcha.Secret != "" {
+		return CaptchaConfig{
+			Provider: "hcaptcha",
+			SiteKey:  c.HCaptcha.SiteKey,
+			Secret:   c.HCaptcha.Secret,
+		}
+	}
+	return c.Captcha
+}
+
+// PoWConfig enables a proof-of-work challenge on claims when Difficulty, the
+// number of leading zero bits required of a solution, is positive.
+type PoWConfig struct {
+	Difficulty int `yaml:"difficulty" toml:"difficulty"`
+	// Secret signs challenges. Instances behind the same load balancer must
+	// share it; a random one is used when empty.
+	Secret string        `yaml:"secret" toml:"secret"`
+	TTL    time.Duration `yaml:"ttl" toml:"ttl"`
+}
+
+// AccessConfig points at files listing the addresses, IPs and CIDR ranges
+// that skip the claim cooldown or may not claim at all.
+type AccessConfig struct {
+	Allowlist string `yaml:"allowlist" toml:"allowlist"`
+	Denylist  string `yaml:"denylist" toml:"denylist"`
+}
+
+// EligibilityConfig restricts claims to recipients with some history, which
+// makes farming the faucet with fresh addresses harder. Zero values disable
+// the corresponding check.
+type EligibilityConfig struct {
+	// MaxBalance is the recipient balance in Ethers above which claims are
+	// refused
+	MaxBalance float64 `yaml:"maxbalance" toml:"maxbalance"`
+	// MinNonce is the number of transactions a recipient must have sent on
+	// the network it claims on
+	MinNonce int `yaml:"minnonce" toml:"minnonce"`
+	// ActivityRPC is the endpoint of another network, typically mainnet, on
+	// which recipients must have sent MinActivity transactions
+	ActivityRPC  string `yaml:"activityrpc" toml:"activityrpc"`
+	ActivityName string `yaml:"activityname" toml:"activityname"`
+	MinActivity  int    `yaml:"minactivity" toml:"minactivity"`
+}
+
+// AuthConfig configures how claimants identify themselves to be paid at a
+// tier other than the anonymous one.
+type AuthConfig struct {
+	// Secret signs sign-in sessions. A random one is used when empty, which
+	// signs everyone out on restart.
+	Secret string `yaml:"secret" toml:"secret"`
+	// KeyFile is the JSON file holding the API keys issued through the
+	// admin API
+	KeyFile string `yaml:"keyfile" toml:"keyfile"`
+	// APIKeys are the hex encoded SHA-256 hashes of accepted API keys.
+	// Deprecated: issue keys through the admin API into KeyFile instead.
+	// Listed keys are still accepted, without limits, but cannot be revoked.
+	APIKeys []string     `yaml:"apikeys" toml:"apikeys"`
+	GitHub  GitHubConfig `yaml:"github" toml:"github"`
+}
+
+// GitHubConfig enables signing in with GitHub through an OAuth app.
+type GitHubConfig struct {
+	ClientID     string `yaml:"clientid" toml:"clientid"`
+	ClientSecret string `yaml:"clientsecret" toml:"clientsecret"`
+}
+
+// TierConfig grants a different payout and cooldown to claimants presenting
+// an identity. The first tier whose identity a claimant presents applies,
+// and claimants presenting none are paid at the network's own settings.
+type TierConfig struct {
+	Name string `yaml:"name" toml:"name"`
+	// Identity is one of apikey, github or allowlist
+	Identity string `yaml:"identity" toml:"identity"`
+	// Amount and Minutes fall back to those of the network when unset or 0
+	Amount  float64 `yaml:"amount" toml:"amount"`
+	Minutes *int    `yaml:"minutes" toml:"minutes"`
+}
+
+// TierIdentities lists the identities a tier can be granted for.
+var TierIdentities = []string{"apikey", "github", "allowlist"}
+
+// AdminConfig enables the operator API once a token or a user and password
+// are set.
+type AdminConfig struct {
+	Token    string `yaml:"token" toml:"token"`
+	User     string `yaml:"user" toml:"user"`
+	Password string `yaml:"password" toml:"password"`
+	// Listen is a separate address to serve the admin API on, such as
+	// 127.0.0.1:9090. It is served on the main port when empty.
+	Listen string `yaml:"listen" toml:"listen"`
+}
+
+// Enabled reports whether any admin credentials are configured.
+func (c AdminConfig) Enabled() bool {
+	return c.Token != "" || c.User != ""
+}
+
+// Default returns the settings used for anything not configured otherwise.
+func Default() *Config {
+	return &Config{
+		HTTPPort: 8080,
+		Faucet: FaucetConfig{
+			Name:    "testnet",
+			Symbol:  "ETH",
+			Amount:  1,
+			Minutes: 1440,
+		},
+		Batch: BatchConfig{
+			Window: 10 * time.Second,
+			Size:   100,
+		},
+		Limiter: LimiterConfig{
+			Backend: "memory",
+			Path:    "limiter.db",
+		},
+		History: HistoryConfig{
+			Retention: 90 * 24 * time.Hour,
+		},
+		Captcha: CaptchaConfig{
+			MinScore: 0.5,
+		},
+		PoW: PoWConfig{
+			TTL: 5 * time.Minute,
+		},
+		Eligibility: EligibilityConfig{
+			ActivityName: "mainnet",
+		},
+		Wallet: WalletConfig{
+			KeyPass:      "password.txt",
+			ReplaceAfter: 3 * time.Minute,
+			MaxFee:       100,
+		},
+	}
+}
+
+// ResolvedNetworks returns the networks to serve with their fallbacks filled
+// in. Without a networks section, the faucet serves a single network
+// described by the faucet and wallet sections.
+func (c *Config) ResolvedNetworks() []NetworkConfig {
+	if len(c.Networks) == 0 {
+		minutes := c.Faucet.Minutes
+		return []NetworkConfig{{
+			Name:     c.Faucet.Name,
+			Provider: c.Wallet.Provider,
+			Symbol:   c.Faucet.Symbol,
+			Amount:   c.Faucet.Amount,
+			Minutes:  &minutes,
+			Tokens:   c.Faucet.Tokens,
+		}}
+	}
+
+	networks := make([]NetworkConfig, len(c.Networks))
+	for i, network := range c.Networks {
+		if network.Provider == "" {
+			network.Provider = c.Wallet.Provider
+		}
+		if network.Symbol == "" {
+			network.Symbol = c.Faucet.Symbol
+		}
+		if network.Amount == 0 {
+			network.Amount = c.Faucet.Amount
+		}
+		if network.Minutes == nil {
+			minutes := c.Faucet.Minutes
+			network.Minutes = &minutes
+		}
+		networks[i] = network
+	}
+	return networks
+}
+
+// Load reads the file at path on top of the current settings. The format is
+// chosen by the file extension, and unknown keys are rejected.
+func (c *Config) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	case ".toml":
+		md, err := toml.Decode(string(data), c)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("%s: unknown key %s", path, undecoded[0])
+		}
+	default:
+		return fmt.Errorf("%s: unsupported config format, expected .yaml, .yml or .toml", path)
+	}
+	return nil
+}
+
+// legacyEnv maps the environment variables supported before config files to
+// their settings. They are applied before the prefixed variables.
+var legacyEnv = map[string]string{
+	"WEB3_PROVIDER":    "wallet.provider",
+	"PRIVATE_KEY":      "wallet.privkeys",
+	"KEYSTORE":         "wallet.keyjson",
+	"HCAPTCHA_SITEKEY": "hcaptcha.sitekey",
+	"HCAPTCHA_SECRET":  "hcaptcha.secret",
+}
+
+// ApplyEnv overrides settings from environment variables looked up with
+// lookup, typically os.LookupEnv. Lists are comma-separated, and tokens are
+// read from FAUCET_TOKENS in the symbol:address:decimals:amount format.
+func (c *Config) ApplyEnv(lookup func(string) (string, bool)) error {
+	for env, key := range legacyEnv {
+		if value, ok := lookup(env); ok && value != "" {
+			if err := c.Set(key, value); err != nil {
+				return fmt.Errorf("%s: %w", env, err)
+			}
+		}
+	}
+
+	var err error
+	walkFields(reflect.ValueOf(c).Elem(), "", func(key string, field reflect.Value) {
+		env := EnvPrefix + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+		if value, ok := lookup(env); ok && err == nil {
+			if setErr := setField(field, value); setErr != nil {
+				err = fmt.Errorf("%s: %w", env, setErr)
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	if value, ok := lookup("FAUCET_TOKENS"); ok && value != "" {
+		tokens, err := ParseTokens(value)
+		if err != nil {
+			return fmt.Errorf("FAUCET_TOKENS: %w", err)
+		}
+		c.Faucet.Tokens = tokens
+	}
+	return nil
+}
+
+// Set assigns value to the setting with the given dotted key, such as
+// "faucet.amount". Only scalar settings and lists of strings can be set.
+func (c *Config) Set(key, value string) error {
+	var found bool
+	var err error
+	walkFields(reflect.ValueOf(c).Elem(), "", func(name string, field reflect.Value) {
+		if name == key {
+			found = true
+			err = setField(field, value)
+		}
+	})
+	if !found {
+		return fmt.Errorf("unknown setting %s", key)
+	}
+	return err
+}
+
+// walkFields calls fn with the dotted key of every scalar or string list
+// field below v.
+func walkFields(v reflect.Value, prefix string, fn func(key string, field reflect.Value)) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		key := prefix + strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+		field := v.Field(i)
+		switch {
+		case field.Kind() == reflect.Struct:
+			walkFields(field, key+".", fn)
+		case field.Kind() == reflect.Slice && field.Type().Elem().Kind() != reflect.String:
+			// Lists of sections are only configurable in files
+		default:
+			fn(key, field)
+		}
+	}
+}
+
+func setField(field reflect.Value, value string) error {
+	if field.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(n))
+	case reflect.Uint8:
+		n, err := strconv.ParseUint(value, 10, 8)
+		if err != nil {
+			return err
+		}
+		field.SetUint(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Slice:
+		var values []string
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+		field.Set(reflect.ValueOf(values))
+	default:
+		return fmt.Errorf("unsupported setting type %s", field.Type())
+	}
+	return nil
+}
+
+// ParseTokens parses a comma-separated list of tokens, each described as
+// symbol:address:decimals:amount.
+func ParseTokens(specs string) ([]TokenConfig, error) {
+	var tokens []TokenConfig
+	for _, spec := range strings.Split(specs, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+
+		parts := strings.Split(spec, ":")
+		if len(parts) != 4 {
+			return nil, fmt.Errorf("invalid token %q: expected symbol:address:decimals:amount", spec)
+		}
+		decimals, err := strconv.ParseUint(parts[2], 10, 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid token %q: bad decimals: %w", spec, err)
+		}
+		amount, err := strconv.ParseFloat(parts[3], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid token %q: bad amount: %w", spec, err)
+		}
+
+		tokens = append(tokens, TokenConfig{
+			Symbol:   parts[0],
+			Address:  parts[1],
+			Decimals: uint8(decimals),
+			Amount:   amount,
+		})
+	}
+	return tokens, nil
+}
+
+// ValidationError lists every problem found in the settings.
+type ValidationError []string
+
+func (e ValidationError) Error() string {
+	return "invalid configuration:\n  " + strings.Join(e, "\n  ")
+}
+
+// Validate checks the settings and reports all problems at once, each
+// prefixed with the key of the offending setting.
+func (c *Config) Validate() error {
+	var problems ValidationError
+	addf := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if c.HTTPPort <= 0 || c.HTTPPort > 65535 {
+		addf("httpport: %d is not a valid port", c.HTTPPort)
+	}
+	if c.ProxyCount < 0 {
+		addf("proxycount: must not be negative")
+	}
+
+	if c.Faucet.Amount <= 0 {
+		addf("faucet.amount: must be positive")
+	}
+	if c.Faucet.Minutes < 0 {
+		addf("faucet.minutes: must not be negative")
+	}
+	if c.Faucet.MinBalance < 0 {
+		addf("faucet.minbalance: must not be negative")
+	}
+	if c.Faucet.LowBalance < 0 {
+		addf("faucet.lowbalance: must not be negative")
+	} else if c.Faucet.LowBalance > 0 && c.Faucet.LowBalance <= c.Faucet.MinBalance {
+		addf("faucet.lowbalance: must be greater than faucet.minbalance")
+	}
+	if c.Faucet.HourlyBudget < 0 {
+		addf("faucet.hourlybudget: must not be negative")
+	}
+	if c.Faucet.DailyBudget < 0 {
+		addf("faucet.dailybudget: must not be negative")
+	}
+	validateTokens("faucet.tokens", c.Faucet.Tokens, addf)
+
+	if len(c.Networks) > 0 && len(c.Faucet.Tokens) > 0 {
+		addf("faucet.tokens: configure tokens per network when networks are set")
+	}
+	names := make(map[string]bool)
+	for i, network := range c.Networks {
+		key := fmt.Sprintf("networks[%d]", i)
+		name := strings.ToLower(network.Name)
+		switch {
+		case !networkNameRe.MatchString(name):
+			addf("%s.name: %q must consist of letters, digits and dashes", key, network.Name)
+		case reservedNetworkNames[name]:
+			addf("%s.name: %q is reserved", key, network.Name)
+		case names[name]:
+			addf("%s.name: duplicate network %s", key, name)
+		}
+		names[name] = true
+		if network.ChainID < 0 {
+			addf("%s.chainid: must not be negative", key)
+		}
+		if network.Provider == "" && c.Wallet.Provider == "" {
+			addf("%s.provider: is required when wallet.provider is not set", key)
+		}
+		if network.Amount < 0 {
+			addf("%s.amount: must not be negative", key)
+		}
+		if network.Minutes != nil && *network.Minutes < 0 {
+			addf("%s.minutes: must not be negative", key)
+		}
+		validateTokens(key+".tokens", network.Tokens, addf)
+	}
+
+	if c.Batch.Contract != "" {
+		if !common.IsHexAddress(c.Batch.Contract) {
+			addf("batch.contract: %q is not a valid address", c.Batch.Contract)
+		}
+		if c.Batch.Size < 2 {
+			addf("batch.size: must be at least 2")
+		}
+		if c.Batch.Window < 0 {
+			addf("batch.window: must not be negative")
+		}
+	}
+
+	switch strings.ToLower(c.Limiter.Backend) {
+	case "memory":
+		// A restart would reset the budgets spent so far
+		if c.Faucet.HourlyBudget > 0 || c.Faucet.DailyBudget > 0 {
+			addf("faucet: hourlybudget and dailybudget require the bolt or redis limiter backend")
+		}
+	case "bolt":
+		if c.Limiter.Path == "" {
+			addf("limiter.path: is required by the bolt backend")
+		}
+	case "redis":
+		if _, err := url.Parse(c.Limiter.Redis); err != nil || c.Limiter.Redis == "" {
+			addf("limiter.redis: a valid URL is required by the redis backend")
+		}
+	default:
+		addf("limiter.backend: unknown backend %q, expected memory, bolt or redis", c.Limiter.Backend)
+	}
+
+	if c.History.Retention < 0 {
+		addf("history.retention: must not be negative")
+	}
+	if c.History.Path != "" && strings.EqualFold(c.Limiter.Backend, "bolt") && filepath.Clean(c.History.Path) == filepath.Clean(c.Limiter.Path) {
+		addf("history.path: must differ from limiter.path")
+	}
+
+	if c.Wallet.Provider == "" && len(c.Networks) == 0 {
+		addf("wallet.provider: is required")
+	}
+	if len(c.Wallet.PrivKeys) == 0 && c.Wallet.KeyJSON == "" {
+		addf("wallet.privkeys: either private keys or wallet.keyjson are required")
+	}
+	for i, key := range c.Wallet.PrivKeys {
+		// Never echo the key itself
+		if _, err := crypto.HexToECDSA(strings.TrimPrefix(strings.TrimPrefix(key, "0x"), "0X")); err != nil {
+			addf("wallet.privkeys[%d]: not a valid private key", i)
+		}
+	}
+	if c.Wallet.ReplaceAfter < 0 {
+		addf("wallet.replaceafter: must not be negative")
+	}
+	if c.Wallet.MaxFee < 0 {
+		addf("wallet.maxfee: must not be negative")
+	}
+
+	if (c.HCaptcha.SiteKey == "") != (c.HCaptcha.Secret == "") {
+		addf("hcaptcha: sitekey and secret must be set together")
+	}
+	if c.Captcha.Provider != "" {
+		known := false
+		for _, provider := range CaptchaProviders {
+			known = known || c.Captcha.Provider == provider
+		}
+		if !known {
+			addf("captcha.provider: unknown provider %q, expected one of %s", c.Captcha.Provider, strings.Join(CaptchaProviders, ", "))
+		}
+		if c.Captcha.SiteKey == "" || c.Captcha.Secret == "" {
+			addf("captcha: sitekey and secret are required by the %s provider", c.Captcha.Provider)
+		}
+		if c.HCaptcha.Secret != "" {
+			addf("hcaptcha: cannot be combined with captcha.provider")
+		}
+	} else if c.Captcha.SiteKey != "" || c.Captcha.Secret != "" {
+		addf("captcha.provider: is required when a sitekey or secret is set")
+	}
+	if c.Captcha.VerifyURL != "" {
+		if u, err := url.Parse(c.Captcha.VerifyURL); err != nil || u.Host == "" {
+			addf("captcha.verifyurl: %q is not a valid URL", c.Captcha.VerifyURL)
+		}
+	}
+	if c.Captcha.MinScore < 0 || c.Captcha.MinScore > 1 {
+		addf("captcha.minscore: must be between 0 and 1")
+	}
+
+	if c.PoW.Difficulty < 0 || c.PoW.Difficulty > maxPoWDifficulty {
+		addf("pow.difficulty: must be between 0 and %d", maxPoWDifficulty)
+	}
+	if c.PoW.Difficulty > 0 && c.PoW.TTL <= 0 {
+		addf("pow.ttl: must be positive")
+	}
+
+	if c.Eligibility.MaxBalance < 0 {
+		addf("eligibility.maxbalance: must not be negative")
+	}
+	if c.Eligibility.MinNonce < 0 {
+		addf("eligibility.minnonce: must not be negative")
+	}
+	if c.Eligibility.MinActivity < 0 {
+		addf("eligibility.minactivity: must not be negative")
+	}
+	if c.Eligibility.MinActivity > 0 && c.Eligibility.ActivityRPC == "" {
+		addf("eligibility.activityrpc: is required when eligibility.minactivity is set")
+	}
+	if c.Eligibility.ActivityRPC != "" {
+		if u, err := url.Parse(c.Eligibility.ActivityRPC); err != nil || u.Host == "" {
+			addf("eligibility.activityrpc: %q is not a valid URL", c.Eligibility.ActivityRPC)
+		}
+	}
+
+	for i, key := range c.Auth.APIKeys {
+		if b, err := hex.DecodeString(key); err != nil || len(b) != sha256.Size {
+			addf("auth.apikeys[%d]: not a hex encoded SHA-256 hash", i)
+		}
+	}
+	if (c.Auth.GitHub.ClientID == "") != (c.Auth.GitHub.ClientSecret == "") {
+		addf("auth.github: clientid and clientsecret must be set together")
+	}
+	tiers := make(map[string]bool)
+	for i, tier := range c.Tiers {
+		key := fmt.Sprintf("tiers[%d]", i)
+		name := strings.ToLower(tier.Name)
+		switch {
+		case name == "":
+			addf("%s.name: is required", key)
+		case name == "anonymous":
+			addf("%s.name: %q is reserved", key, tier.Name)
+		case tiers[name]:
+			addf("%s.name: duplicate tier %s", key, name)
+		}
+		tiers[name] = true
+		switch tier.Identity {
+		case "github":
+			if c.Auth.GitHub.ClientID == "" {
+				addf("%s.identity: auth.github is required by the github identity", key)
+			}
+		case "apikey", "allowlist":
+		default:
+			addf("%s.identity: unknown identity %q, expected one of %s", key, tier.Identity, strings.Join(TierIdentities, ", "))
+		}
+		if tier.Amount < 0 {
+			addf("%s.amount: must not be negative", key)
+		}
+		if tier.Minutes != nil && *tier.Minutes < 0 {
+			addf("%s.minutes: must not be negative", key)
+		}
+	}
+
+	if (c.Admin.User == "") != (c.Admin.Password == "") {
+		addf("admin: user and password must be set together")
+	}
+	if c.Admin.Listen != "" {
+		if !c.Admin.Enabled() {
+			addf("admin.listen: a token or user and password are required to serve the admin API")
+		}
+		if _, _, err := net.SplitHostPort(c.Admin.Listen); err != nil {
+			addf("admin.listen: %q is not a valid address", c.Admin.Listen)
+		}
+	}
+
+	if len(problems) > 0 {
+		return problems
+	}
+	return nil
+}
+
+// maxPoWDifficulty bounds the work asked of clients, which doubles with
+// every bit of difficulty.
+const maxPoWDifficulty = 32
+
+var networkNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// reservedNetworkNames would clash with the endpoints of the default network.
+var reservedNetworkNames = map[string]bool{"claim": true, "info": true, "stats": true, "recent": true}
+
+func validateTokens(key string, tokens []TokenConfig, addf func(string, ...interface{})) {
+	symbols := make(map[string]bool)
+	for i, token := range tokens {
+		key := fmt.Sprintf("%s[%d]", key, i)
+		if token.Symbol == "" {
+			addf("%s.symbol: is required", key)
+		} else if symbol := strings.ToUpper(token.Symbol); symbols[symbol] {
+			addf("%s.symbol: duplicate token %s", key, symbol)
+		} else {
+			symbols[symbol] = true
+		}
+		if !common.IsHexAddress(token.Address) {
+			addf("%s.address: %q is not a valid address", key, token.Address)
+		}
+		if token.Amount <= 0 {
+			addf("%s.amount: must be positive", key)
+		}
+	}
+}
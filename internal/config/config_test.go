@@ -0,0 +1,251 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testKey = "976f9f7772781ff6d1c93941129d417c49a209c674056a3cf5e27e225ee55fa8"
+
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	files := map[string]string{
+		"faucet.yaml": `
+httpport: 9090
+faucet:
+  amount: 0.5
+  tokens:
+    - symbol: USDC
+      address: "0x1c7D4B196Cb0C7B01d743Fbc6116a902379C7238"
+      decimals: 6
+      amount: 10
+batch:
+  window: 30s
+wallet:
+  provider: http://localhost:8545
+  privkeys: ["` + testKey + `"]
+`,
+		"faucet.toml": `
+httpport = 9090
+
+[faucet]
+amount = 0.5
+
+[[faucet.tokens]]
+symbol = "USDC"
+address = "0x1c7D4B196Cb0C7B01d743Fbc6116a902379C7238"
+decimals = 6
+amount = 10
+
+[batch]
+window = "30s"
+
+[wallet]
+provider = "http://localhost:8545"
+privkeys = ["` + testKey + `"]
+`,
+	}
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			cfg := Default()
+			if err := cfg.Load(writeFile(t, name, content)); err != nil {
+				t.Fatal(err)
+			}
+			if err := cfg.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			if cfg.HTTPPort != 9090 || cfg.Faucet.Amount != 0.5 || cfg.Batch.Window != 30*time.Second {
+				t.Errorf("settings not loaded: %+v", cfg)
+			}
+			if len(cfg.Faucet.Tokens) != 1 || cfg.Faucet.Tokens[0].Decimals != 6 {
+				t.Errorf("tokens not loaded: %+v", cfg.Faucet.Tokens)
+			}
+			// Settings missing from the file keep their defaults
+			if cfg.Faucet.Minutes != 1440 || cfg.Limiter.Backend != "memory" {
+				t.Errorf("defaults were overwritten: %+v", cfg)
+			}
+		})
+	}
+}
+
+func TestLoadRejectsUnknownKeys(t *testing.T) {
+	files := map[string]string{
+		"faucet.yaml": "faucet:\n  amout: 1\n",
+		"faucet.toml": "[faucet]\namout = 1\n",
+		"faucet.json": "{}",
+	}
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			if err := Default().Load(writeFile(t, name, content)); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	env := map[string]string{
+		"WEB3_PROVIDER":          "http://legacy:8545",
+		"FAUCET_WALLET_PROVIDER": "http://localhost:8545",
+		"PRIVATE_KEY":            testKey + "," + testKey,
+		"FAUCET_FAUCET_AMOUNT":   "2.5",
+		"FAUCET_HTTPPORT":        "9000",
+		"FAUCET_BATCH_WINDOW":    "1m",
+		"FAUCET_TOKENS":          "USDC:0x1c7D4B196Cb0C7B01d743Fbc6116a902379C7238:6:10",
+	}
+	cfg := Default()
+	err := cfg.ApplyEnv(func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Wallet.Provider != "http://localhost:8545" {
+		t.Errorf("expected prefixed variable to win over the legacy one, got %s", cfg.Wallet.Provider)
+	}
+	if len(cfg.Wallet.PrivKeys) != 2 || cfg.Faucet.Amount != 2.5 || cfg.HTTPPort != 9000 || cfg.Batch.Window != time.Minute {
+		t.Errorf("environment not applied: %+v", cfg)
+	}
+	if len(cfg.Faucet.Tokens) != 1 || cfg.Faucet.Tokens[0].Symbol != "USDC" {
+		t.Errorf("tokens not applied: %+v", cfg.Faucet.Tokens)
+	}
+
+	err = Default().ApplyEnv(func(key string) (string, bool) {
+		return "many", key == "FAUCET_FAUCET_MINUTES"
+	})
+	if err == nil || !strings.Contains(err.Error(), "FAUCET_FAUCET_MINUTES") {
+		t.Errorf("expected error naming the variable, got %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*Config)
+		want   string
+	}{
+		{name: "valid", modify: func(*Config) {}},
+		{name: "port", modify: func(c *Config) { c.HTTPPort = 70000 }, want: "httpport: 70000 is not a valid port"},
+		{name: "amount", modify: func(c *Config) { c.Faucet.Amount = 0 }, want: "faucet.amount: must be positive"},
+		{name: "low balance", modify: func(c *Config) { c.Faucet.MinBalance, c.Faucet.LowBalance = 2, 1 }, want: "faucet.lowbalance: must be greater than faucet.minbalance"},
+		{name: "budget", modify: func(c *Config) { c.Faucet.DailyBudget = -1 }, want: "faucet.dailybudget: must not be negative"},
+		{name: "budget in memory", modify: func(c *Config) { c.Faucet.HourlyBudget = 10 }, want: "faucet: hourlybudget and dailybudget require the bolt or redis limiter backend"},
+		{name: "history path", modify: func(c *Config) {
+			c.Limiter.Backend, c.History.Path = "bolt", "limiter.db"
+		}, want: "history.path: must differ from limiter.path"},
+		{name: "token address", modify: func(c *Config) {
+			c.Faucet.Tokens = []TokenConfig{{Symbol: "USDC", Address: "0x12", Amount: 1}}
+		}, want: `faucet.tokens[0].address: "0x12" is not a valid address`},
+		{name: "duplicate token", modify: func(c *Config) {
+			token := TokenConfig{Symbol: "usdc", Address: "0x1c7D4B196Cb0C7B01d743Fbc6116a902379C7238", Amount: 1}
+			c.Faucet.Tokens = []TokenConfig{token, token}
+		}, want: "faucet.tokens[1].symbol: duplicate token USDC"},
+		{name: "network name", modify: func(c *Config) {
+			c.Networks = []NetworkConfig{{Name: "sepolia"}, {Name: "Info"}}
+		}, want: `networks[1].name: "Info" is reserved`},
+		{name: "stats network", modify: func(c *Config) {
+			c.Networks = []NetworkConfig{{Name: "stats"}}
+		}, want: `networks[0].name: "stats" is reserved`},
+		{name: "duplicate network", modify: func(c *Config) {
+			c.Networks = []NetworkConfig{{Name: "sepolia"}, {Name: "Sepolia"}}
+		}, want: "networks[1].name: duplicate network sepolia"},
+		{name: "network provider", modify: func(c *Config) {
+			c.Wallet.Provider = ""
+			c.Networks = []NetworkConfig{{Name: "sepolia"}}
+		}, want: "networks[0].provider: is required when wallet.provider is not set"},
+		{name: "tokens with networks", modify: func(c *Config) {
+			c.Faucet.Tokens = []TokenConfig{{Symbol: "USDC", Address: "0x1c7D4B196Cb0C7B01d743Fbc6116a902379C7238", Amount: 1}}
+			c.Networks = []NetworkConfig{{Name: "sepolia"}}
+		}, want: "faucet.tokens: configure tokens per network when networks are set"},
+		{name: "batch size", modify: func(c *Config) {
+			c.Batch.Contract, c.Batch.Size = "0xD152f549545093347A162Dce210e7293f1452150", 1
+		}, want: "batch.size: must be at least 2"},
+		{name: "limiter", modify: func(c *Config) { c.Limiter.Backend = "redis" }, want: "limiter.redis: a valid URL is required by the redis backend"},
+		{name: "provider", modify: func(c *Config) { c.Wallet.Provider = "" }, want: "wallet.provider: is required"},
+		{name: "private key", modify: func(c *Config) { c.Wallet.PrivKeys = []string{"0xnotakey"} }, want: "wallet.privkeys[0]: not a valid private key"},
+		{name: "hcaptcha", modify: func(c *Config) { c.HCaptcha.Secret = "secret" }, want: "hcaptcha: sitekey and secret must be set together"},
+		{name: "captcha provider", modify: func(c *Config) {
+			c.Captcha = CaptchaConfig{Provider: "recaptcha-v4", SiteKey: "sitekey", Secret: "secret"}
+		}, want: `captcha.provider: unknown provider "recaptcha-v4"`},
+		{name: "captcha with hcaptcha", modify: func(c *Config) {
+			c.Captcha = CaptchaConfig{Provider: "turnstile", SiteKey: "sitekey", Secret: "secret"}
+			c.HCaptcha = HCaptchaConfig{SiteKey: "sitekey", Secret: "secret"}
+		}, want: "hcaptcha: cannot be combined with captcha.provider"},
+		{name: "pow difficulty", modify: func(c *Config) { c.PoW.Difficulty = 40 }, want: "pow.difficulty: must be between 0 and 32"},
+		{name: "tier identity", modify: func(c *Config) {
+			c.Tiers = []TierConfig{{Name: "partners", Identity: "github"}}
+		}, want: "tiers[0].identity: auth.github is required by the github identity"},
+		{name: "api key hash", modify: func(c *Config) { c.Auth.APIKeys = []string{"secret"} }, want: "auth.apikeys[0]: not a hex encoded SHA-256 hash"},
+		{name: "activity without rpc", modify: func(c *Config) { c.Eligibility.MinActivity = 1 }, want: "eligibility.activityrpc: is required when eligibility.minactivity is set"},
+		{name: "admin", modify: func(c *Config) { c.Admin.User = "ops" }, want: "admin: user and password must be set together"},
+		{name: "admin listen", modify: func(c *Config) { c.Admin.Listen = "127.0.0.1:9090" }, want: "admin.listen: a token or user and password are required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			cfg.Wallet.Provider = "http://localhost:8545"
+			cfg.Wallet.PrivKeys = []string{"0x" + testKey}
+			tt.modify(cfg)
+
+			err := cfg.Validate()
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestResolvedNetworks(t *testing.T) {
+	cfg := Default()
+	cfg.Wallet.Provider = "http://localhost:8545"
+	networks := cfg.ResolvedNetworks()
+	if len(networks) != 1 || networks[0].Name != cfg.Faucet.Name || networks[0].Provider != cfg.Wallet.Provider || *networks[0].Minutes != cfg.Faucet.Minutes {
+		t.Errorf("expected a single network from the faucet section, got %+v", networks)
+	}
+
+	minutes := 0
+	cfg.Networks = []NetworkConfig{
+		{Name: "sepolia"},
+		{Name: "holesky", Provider: "http://holesky:8545", Symbol: "HETH", Amount: 5, Minutes: &minutes},
+	}
+	networks = cfg.ResolvedNetworks()
+	if networks[0].Provider != cfg.Wallet.Provider || networks[0].Symbol != cfg.Faucet.Symbol || networks[0].Amount != cfg.Faucet.Amount || *networks[0].Minutes != cfg.Faucet.Minutes {
+		t.Errorf("expected fallbacks to be filled in, got %+v", networks[0])
+	}
+	if networks[1].Provider != "http://holesky:8545" || networks[1].Symbol != "HETH" || networks[1].Amount != 5 || *networks[1].Minutes != 0 {
+		t.Errorf("expected network settings to be kept, got %+v", networks[1])
+	}
+}
+
+func TestParseTokens(t *testing.T) {
+	tokens, err := ParseTokens("USDC:0x1c7D4B196Cb0C7B01d743Fbc6116a902379C7238:6:10, GOV:0x5FbDB2315678afecb367f032d93F642f64180aa3:18:100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 2 || tokens[1].Symbol != "GOV" || tokens[1].Decimals != 18 || tokens[1].Amount != 100 {
+		t.Errorf("unexpected tokens %+v", tokens)
+	}
+
+	for _, spec := range []string{"USDC:0x1c7D4B196Cb0C7B01d743Fbc6116a902379C7238:6", "USDC:0x1c7D4B196Cb0C7B01d743Fbc6116a902379C7238:x:10"} {
+		if _, err := ParseTokens(spec); err == nil {
+			t.Errorf("expected error for %q", spec)
+		}
+	}
+}
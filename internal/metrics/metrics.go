@@ -0,0 +1,78 @@
+// Package metrics holds the Prometheus collectors shared by the chain and
+// server packages, and serves them on the faucet's /metrics endpoint.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "faucet"
+
+// Reasons a claim is rejected for.
+const (
+	ReasonMalformed        = "malformed"
+	ReasonRateLimited      = "rate_limited"
+	ReasonCaptchaFailed    = "captcha_failed"
+	ReasonUnsupportedToken = "unsupported_token"
+	ReasonLowFunds         = "low_funds"
+	ReasonQueueFull        = "queue_full"
+	ReasonTxFailed         = "tx_failed"
+	ReasonPaused           = "paused"
+	ReasonDenied           = "denied"
+	ReasonPoWFailed        = "pow_failed"
+	ReasonIneligible       = "ineligible"
+	ReasonInvalidAPIKey    = "invalid_api_key"
+	ReasonBudgetExhausted  = "budget_exhausted"
+	ReasonEligibilityError = "eligibility_unavailable"
+)
+
+var (
+	ClaimsAccepted = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "claims_accepted_total",
+		Help:      "Number of claims accepted into the queue.",
+	})
+	ClaimsRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "claims_rejected_total",
+		Help:      "Number of claims rejected or failed, by reason.",
+	}, []string{"reason"})
+
+	TxSendDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "tx_send_duration_seconds",
+		Help:      "Time taken to build, sign and broadcast a transaction.",
+		Buckets:   prometheus.DefBuckets,
+	})
+	RPCErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rpc_errors_total",
+		Help:      "Number of failed JSON-RPC calls to the node, by method.",
+	}, []string{"method"})
+	Nonce = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "account_nonce",
+		Help:      "Next nonce of each funding account.",
+	}, []string{"address"})
+)
+
+// Handler serves the shared collectors together with the given ones, which
+// typically report state owned by a single server.
+func Handler(extra ...prometheus.Collector) http.Handler {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		ClaimsAccepted,
+		ClaimsRejected,
+		TxSendDuration,
+		RPCErrors,
+		Nonce,
+	)
+	registry.MustRegister(extra...)
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,251 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// AccessList matches claims by recipient address or client IP. Entries are
+// addresses, IPs or CIDR ranges, read from a file with one entry per line
+// and # starting a comment.
+type AccessList struct {
+	mu        sync.RWMutex
+	path      string
+	addresses map[common.Address]bool
+	networks  map[string]*net.IPNet
+}
+
+func NewAccessList() *AccessList {
+	return &AccessList{
+		addresses: make(map[common.Address]bool),
+		networks:  make(map[string]*net.IPNet),
+	}
+}
+
+// Load replaces the entries with those in the file at path, which later
+// edits are written back to. An empty path clears the list. The entries are
+// left untouched if the file cannot be read.
+func (l *AccessList) Load(path string) error {
+	list := NewAccessList()
+	if path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		for line := 1; scanner.Scan(); line++ {
+			entry := strings.TrimSpace(strings.SplitN(scanner.Text(), "#", 2)[0])
+			if entry == "" {
+				continue
+			}
+			if err := list.add(entry); err != nil {
+				return fmt.Errorf("%s:%d: %w", path, line, err)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.path = path
+	l.addresses, l.networks = list.addresses, list.networks
+	return nil
+}
+
+// Reload reads the file at path if it is not the one the list was loaded
+// from. Entries edited since the file was loaded are kept when path is
+// unchanged or empty.
+func (l *AccessList) Reload(path string) error {
+	l.mu.RLock()
+	loaded := l.path
+	l.mu.RUnlock()
+	if path == "" || path == loaded {
+		return nil
+	}
+	return l.Load(path)
+}
+
+// Add inserts an address, IP or CIDR range into the list. The entry is not
+// added if the file cannot be written.
+func (l *AccessList) Add(entry string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	next := l.clone()
+	if err := next.add(entry); err != nil {
+		return err
+	}
+	return l.replace(next)
+}
+
+// Remove deletes an entry from the list and reports whether it was present.
+// The entry is kept if the file cannot be written.
+func (l *AccessList) Remove(entry string) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	next := l.clone()
+	entry = strings.TrimSpace(entry)
+	if common.IsHexAddress(entry) {
+		address := common.HexToAddress(entry)
+		if !next.addresses[address] {
+			return false, nil
+		}
+		delete(next.addresses, address)
+		return true, l.replace(next)
+	}
+	ipNet, err := parseIPNet(entry)
+	if err != nil {
+		return false, err
+	}
+	if _, ok := next.networks[ipNet.String()]; !ok {
+		return false, nil
+	}
+	delete(next.networks, ipNet.String())
+	return true, l.replace(next)
+}
+
+// Contains reports whether the address or the IP is on the list.
+func (l *AccessList) Contains(address, ip string) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if common.IsHexAddress(address) && l.addresses[common.HexToAddress(address)] {
+		return true
+	}
+	if parsed := net.ParseIP(ip); parsed != nil {
+		for _, ipNet := range l.networks {
+			if ipNet.Contains(parsed) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Entries returns the addresses followed by the IP ranges on the list.
+func (l *AccessList) Entries() []string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.entries()
+}
+
+func (l *AccessList) entries() []string {
+	addresses := make([]string, 0, len(l.addresses))
+	for address := range l.addresses {
+		addresses = append(addresses, address.Hex())
+	}
+	networks := make([]string, 0, len(l.networks))
+	for network := range l.networks {
+		networks = append(networks, network)
+	}
+	sort.Strings(addresses)
+	sort.Strings(networks)
+	return append(addresses, networks...)
+}
+
+func (l *AccessList) add(entry string) error {
+	entry = strings.TrimSpace(entry)
+	if common.IsHexAddress(entry) {
+		l.addresses[common.HexToAddress(entry)] = true
+		return nil
+	}
+	ipNet, err := parseIPNet(entry)
+	if err != nil {
+		return err
+	}
+	l.networks[ipNet.String()] = ipNet
+	return nil
+}
+
+// clone copies the entries of the list, for an edit to be saved before it
+// applies. It must be called with l.mu held.
+func (l *AccessList) clone() *AccessList {
+	next := NewAccessList()
+	next.path = l.path
+	for address := range l.addresses {
+		next.addresses[address] = true
+	}
+	for network, ipNet := range l.networks {
+		next.networks[network] = ipNet
+	}
+	return next
+}
+
+// replace writes the entries of next to the file of the list and then swaps
+// them in, keeping the current ones if that fails. It must be called with
+// l.mu held.
+func (l *AccessList) replace(next *AccessList) error {
+	if err := next.save(); err != nil {
+		return err
+	}
+	l.addresses, l.networks = next.addresses, next.networks
+	return nil
+}
+
+// save writes the list back to its file, if it has one.
+func (l *AccessList) save() error {
+	if l.path == "" {
+		return nil
+	}
+
+	var b strings.Builder
+	for _, entry := range l.entries() {
+		b.WriteString(entry + "\n")
+	}
+	// Replace the file in one step, so it is never read half written
+	tmp, err := os.CreateTemp(filepath.Dir(l.path), filepath.Base(l.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(b.String()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), l.path)
+}
+
+// parseIPNet parses a CIDR range, or a single IP as a range of one.
+func parseIPNet(entry string) (*net.IPNet, error) {
+	if strings.Contains(entry, "/") {
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a valid address, IP or CIDR range", entry)
+		}
+		return ipNet, nil
+	}
+	ip := net.ParseIP(entry)
+	if ip == nil {
+		return nil, fmt.Errorf("%q is not a valid address, IP or CIDR range", entry)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+// checkAccessEntry returns an error unless entry is an address, IP or CIDR
+// range.
+func checkAccessEntry(entry string) error {
+	entry = strings.TrimSpace(entry)
+	if common.IsHexAddress(entry) {
+		return nil
+	}
+	_, err := parseIPNet(entry)
+	return err
+}
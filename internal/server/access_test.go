@@ -0,0 +1,85 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAccessList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "denylist.txt")
+	content := `# known drainers
+0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045
+10.0.0.0/8   # abusive range
+2001:db8::1
+`
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	list := NewAccessList()
+	if err := list.Load(path); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		address string
+		ip      string
+		want    bool
+	}{
+		{"0xd8da6bf26964af9d7eed9e03e53415d37aa96045", "192.0.2.1", true},
+		{"0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", "10.1.2.3", true},
+		{"0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", "2001:db8::1", true},
+		{"0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", "192.0.2.1", false},
+	}
+	for _, tt := range tests {
+		if got := list.Contains(tt.address, tt.ip); got != tt.want {
+			t.Errorf("Contains(%s, %s) = %v, want %v", tt.address, tt.ip, got, tt.want)
+		}
+	}
+
+	if err := list.Add("192.0.2.0/24"); err != nil {
+		t.Fatal(err)
+	}
+	if removed, err := list.Remove("10.0.0.0/8"); err != nil || !removed {
+		t.Fatalf("Remove() = %v, %v", removed, err)
+	}
+	if err := list.Add("not an entry"); err == nil {
+		t.Error("Add() accepted an invalid entry")
+	}
+
+	// Edits are written back to the file
+	reloaded := NewAccessList()
+	if err := reloaded.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045", "192.0.2.0/24", "2001:db8::1/128"}
+	if got := reloaded.Entries(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Entries() after reload = %v, want %v", got, want)
+	}
+
+	if err := os.WriteFile(path, []byte("10.0.0.0/33\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := reloaded.Load(path); err == nil {
+		t.Error("Load() accepted an invalid range")
+	}
+	if len(reloaded.Entries()) != 3 {
+		t.Error("Load() of an invalid file changed the entries")
+	}
+
+	// Edits only apply once they are saved
+	reloaded.path = filepath.Join(t.TempDir(), "missing", "denylist.txt")
+	if err := reloaded.Add("198.51.100.1"); err == nil {
+		t.Error("Add() succeeded without saving the entry")
+	}
+	if _, err := reloaded.Remove("192.0.2.0/24"); err == nil {
+		t.Error("Remove() succeeded without saving the list")
+	}
+	if got := reloaded.Entries(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Entries() after failed edits = %v, want %v", got, want)
+	}
+	if err := reloaded.Reload(""); err != nil || !reflect.DeepEqual(reloaded.Entries(), want) {
+		t.Errorf("Reload() with no file = %v, entries %v, want %v", err, reloaded.Entries(), want)
+	}
+}
@@ -0,0 +1,490 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/negroni/v3"
+
+	"github.com/chainflag/eth-faucet/internal/chain"
+)
+
+const (
+	defaultRecentClaims = 50
+	maxRecentClaims     = 1000
+	defaultHistory      = 100
+	maxHistory          = 100000
+)
+
+// adminRouter serves the operator API under /admin. Every endpoint acts on
+// the network named by the network query parameter, or the default one.
+func (s *Server) adminRouter() http.Handler {
+	router := http.NewServeMux()
+	router.HandleFunc("/admin/claims", s.handleAdminClaims)
+	router.HandleFunc("/admin/limits/", s.handleAdminClearLimit)
+	router.HandleFunc("/admin/pause", s.handleAdminPause(true))
+	router.HandleFunc("/admin/resume", s.handleAdminPause(false))
+	router.HandleFunc("/admin/payout", s.handleAdminPayout)
+	router.HandleFunc("/admin/nonce", s.handleAdminNonce)
+	router.HandleFunc("/admin/allowlist", s.handleAdminAccessList("allowlist", s.allowlist))
+	router.HandleFunc("/admin/denylist", s.handleAdminAccessList("denylist", s.denylist))
+	router.HandleFunc("/admin/apikeys", s.handleAdminAPIKeys)
+	router.HandleFunc("/admin/apikeys/", s.handleAdminRevokeAPIKey)
+	router.HandleFunc("/admin/history", s.handleAdminHistory)
+	return negroni.New(negroni.HandlerFunc(s.authorizeAdmin), negroni.Wrap(router))
+}
+
+// authorizeAdmin accepts either the bearer token or the basic auth
+// credentials of the current settings. Without any, the API is disabled.
+func (s *Server) authorizeAdmin(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	admin := s.current().cfg.admin
+	if !admin.Enabled() {
+		http.NotFound(w, r)
+		return
+	}
+
+	authorized := false
+	if auth := r.Header.Get("Authorization"); admin.Token != "" && strings.HasPrefix(auth, "Bearer ") {
+		authorized = secureCompare(strings.TrimPrefix(auth, "Bearer "), admin.Token)
+	} else if user, password, ok := r.BasicAuth(); ok && admin.User != "" {
+		// Evaluate both to not reveal which one was wrong through timing
+		userOK, passwordOK := secureCompare(user, admin.User), secureCompare(password, admin.Password)
+		authorized = userOK && passwordOK
+	}
+	if !authorized {
+		if admin.User != "" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="eth-faucet admin"`)
+		}
+		renderJSON(w, claimResponse{Message: "Unauthorized"}, http.StatusUnauthorized)
+		return
+	}
+	next(w, r)
+}
+
+func secureCompare(given, expected string) bool {
+	return subtle.ConstantTimeCompare([]byte(given), []byte(expected)) == 1
+}
+
+// handleAdminAccessList lists the entries of an access list on GET, adds the
+// entry in the request body on POST and removes the entry given by the entry
+// query parameter on DELETE.
+func (s *Server) handleAdminAccessList(name string, list *AccessList) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			renderJSON(w, list.Entries(), http.StatusOK)
+		case http.MethodPost:
+			var req adminAccessRequest
+			if err := decodeJSONBody(r, &req); err != nil {
+				var mr *malformedRequest
+				if errors.As(err, &mr) {
+					renderJSON(w, claimResponse{Message: mr.message}, mr.status)
+				} else {
+					renderJSON(w, claimResponse{Message: http.StatusText(http.StatusInternalServerError)}, http.StatusInternalServerError)
+				}
+				return
+			}
+			if err := checkAccessEntry(req.Entry); err != nil {
+				renderJSON(w, claimResponse{Message: err.Error()}, http.StatusBadRequest)
+				return
+			}
+			if err := list.Add(req.Entry); err != nil {
+				log.WithError(err).Errorf("Failed to save %s", name)
+				renderJSON(w, claimResponse{Message: fmt.Sprintf("Failed to add to the %s: %v", name, err)}, http.StatusInternalServerError)
+				return
+			}
+			log.WithField("entry", req.Entry).Infof("Entry added to %s by admin", name)
+			renderJSON(w, claimResponse{Message: fmt.Sprintf("Added %s to the %s", req.Entry, name)}, http.StatusOK)
+		case http.MethodDelete:
+			entry := r.URL.Query().Get("entry")
+			if err := checkAccessEntry(entry); err != nil {
+				renderJSON(w, claimResponse{Message: err.Error()}, http.StatusBadRequest)
+				return
+			}
+			removed, err := list.Remove(entry)
+			if err != nil {
+				log.WithError(err).Errorf("Failed to save %s", name)
+				renderJSON(w, claimResponse{Message: fmt.Sprintf("Failed to remove from the %s: %v", name, err)}, http.StatusInternalServerError)
+				return
+			}
+			if !removed {
+				renderJSON(w, claimResponse{Message: fmt.Sprintf("%s is not on the %s", entry, name)}, http.StatusNotFound)
+				return
+			}
+			log.WithField("entry", entry).Infof("Entry removed from %s by admin", name)
+			renderJSON(w, claimResponse{Message: fmt.Sprintf("Removed %s from the %s", entry, name)}, http.StatusOK)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// adminNetwork looks up the network an admin request acts on, answering the
+// request itself if there is no such network.
+func (s *Server) adminNetwork(w http.ResponseWriter, r *http.Request) (*network, bool) {
+	id := r.URL.Query().Get("network")
+	if id == "" {
+		return s.networks[0], true
+	}
+	for _, n := range s.networks {
+		if n.id == strings.ToLower(id) {
+			return n, true
+		}
+	}
+	renderJSON(w, claimResponse{Message: fmt.Sprintf("Unknown network %s", id)}, http.StatusNotFound)
+	return nil, false
+}
+
+func (s *Server) handleAdminClaims(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	n, ok := s.adminNetwork(w, r)
+	if !ok {
+		return
+	}
+
+	limit := defaultRecentClaims
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit <= 0 {
+			renderJSON(w, claimResponse{Message: "limit must be a positive number"}, http.StatusBadRequest)
+			return
+		}
+		if limit > maxRecentClaims {
+			limit = maxRecentClaims
+		}
+	}
+
+	st := n.current()
+	recent := n.dispatcher.Recent(limit)
+	claims := make([]adminClaim, len(recent))
+	for i, status := range recent {
+		claim := adminClaim{
+			claimStatusResponse: newClaimStatusResponse(status),
+			Network:             st.cfg.network,
+			Address:             status.Request.To,
+			Amount:              chain.FromBaseUnits(status.Request.Value, 18),
+			CreatedAt:           status.CreatedAt,
+		}
+		if token := status.Request.Token; token != nil {
+			// Tokens removed from the configuration are reported in base units
+			claim.Token, claim.Amount = token.Hex(), status.Request.Value.String()
+			for _, t := range st.cfg.tokens {
+				if t.Address == *token {
+					claim.Token, claim.Amount = t.Symbol, chain.FromBaseUnits(status.Request.Value, t.Decimals)
+					break
+				}
+			}
+		}
+		claims[i] = claim
+	}
+	renderJSON(w, claims, http.StatusOK)
+}
+
+func (s *Server) handleAdminClearLimit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	n, ok := s.adminNetwork(w, r)
+	if !ok {
+		return
+	}
+
+	key := path.Base(r.URL.Path)
+	switch {
+	case chain.IsValidAddress(key, false):
+		key = common.HexToAddress(key).Hex()
+	case net.ParseIP(key) != nil:
+	default:
+		renderJSON(w, claimResponse{Message: "Expected an address or IP"}, http.StatusBadRequest)
+		return
+	}
+
+	tokens := make([]string, len(n.current().cfg.tokens))
+	for i, token := range n.current().cfg.tokens {
+		tokens[i] = token.Symbol
+	}
+	if err := n.limiter.Clear(r.Context(), key, tokens); err != nil {
+		log.WithError(err).Error("Failed to clear rate limit records")
+		renderJSON(w, claimResponse{Message: http.StatusText(http.StatusInternalServerError)}, http.StatusInternalServerError)
+		return
+	}
+	log.WithFields(log.Fields{
+		"network": n.id,
+		"key":     key,
+	}).Info("Rate limit cleared by admin")
+	renderJSON(w, claimResponse{Message: fmt.Sprintf("Rate limit cleared for %s", key)}, http.StatusOK)
+}
+
+func (s *Server) handleAdminPause(paused bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		n, ok := s.adminNetwork(w, r)
+		if !ok {
+			return
+		}
+
+		n.setPaused(paused)
+		state := "resumed"
+		if paused {
+			state = "paused"
+		}
+		log.WithField("network", n.id).Infof("Claims %s by admin", state)
+		renderJSON(w, claimResponse{Message: fmt.Sprintf("Claims %s on %s", state, n.current().cfg.network)}, http.StatusOK)
+	}
+}
+
+func (s *Server) handleAdminPayout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	n, ok := s.adminNetwork(w, r)
+	if !ok {
+		return
+	}
+
+	var req adminPayoutRequest
+	if err := decodeJSONBody(r, &req); err != nil {
+		var mr *malformedRequest
+		if errors.As(err, &mr) {
+			renderJSON(w, claimResponse{Message: mr.message}, mr.status)
+		} else {
+			renderJSON(w, claimResponse{Message: http.StatusText(http.StatusInternalServerError)}, http.StatusInternalServerError)
+		}
+		return
+	}
+	if req.Amount <= 0 {
+		renderJSON(w, claimResponse{Message: "amount must be positive"}, http.StatusBadRequest)
+		return
+	}
+
+	n.setPayout(req.Amount)
+	log.WithFields(log.Fields{
+		"network": n.id,
+		"payout":  req.Amount,
+	}).Info("Payout changed by admin")
+	renderJSON(w, claimResponse{Message: fmt.Sprintf("Payout set to %s %s", strconv.FormatFloat(req.Amount, 'f', -1, 64), n.current().cfg.symbol)}, http.StatusOK)
+}
+
+func (s *Server) handleAdminNonce(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	n, ok := s.adminNetwork(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+	if err := n.txBuilder.RefreshNonce(ctx); err != nil {
+		renderJSON(w, claimResponse{Message: fmt.Sprintf("Failed to refresh nonce: %v", err)}, http.StatusBadGateway)
+		return
+	}
+	log.WithField("network", n.id).Info("Nonce refreshed by admin")
+	renderJSON(w, claimResponse{Message: "Nonce refreshed"}, http.StatusOK)
+}
+
+// handleAdminAPIKeys lists the API keys with their usage on the network on
+// GET, and issues a key on POST. The key is only ever shown in the response
+// it is issued in.
+func (s *Server) handleAdminAPIKeys(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		n, ok := s.adminNetwork(w, r)
+		if !ok {
+			return
+		}
+		keys := s.apiKeys.List()
+		resp := make([]adminAPIKey, len(keys))
+		for i := range keys {
+			claims, paid, today, err := usageOf(r.Context(), n.store, &keys[i])
+			if err != nil {
+				log.WithError(err).Error("Failed to read API key usage")
+				renderJSON(w, claimResponse{Message: http.StatusText(http.StatusInternalServerError)}, http.StatusInternalServerError)
+				return
+			}
+			resp[i] = adminAPIKey{
+				APIKey:     keys[i],
+				Claims:     claims,
+				Paid:       gweiToEther(paid),
+				SpentToday: gweiToEther(today),
+			}
+		}
+		renderJSON(w, resp, http.StatusOK)
+	case http.MethodPost:
+		var req adminAPIKeyRequest
+		if err := decodeJSONBody(r, &req); err != nil {
+			var mr *malformedRequest
+			if errors.As(err, &mr) {
+				renderJSON(w, claimResponse{Message: mr.message}, mr.status)
+			} else {
+				renderJSON(w, claimResponse{Message: http.StatusText(http.StatusInternalServerError)}, http.StatusInternalServerError)
+			}
+			return
+		}
+		if strings.TrimSpace(req.Name) == "" {
+			renderJSON(w, claimResponse{Message: "name is required"}, http.StatusBadRequest)
+			return
+		}
+		if req.RateLimit < 0 || req.MaxAmount < 0 || req.DailyBudget < 0 {
+			renderJSON(w, claimResponse{Message: "rate_limit, max_amount and daily_budget must not be negative"}, http.StatusBadRequest)
+			return
+		}
+		raw, key, err := s.apiKeys.Issue(req.Name, req.RateLimit, req.MaxAmount, req.DailyBudget)
+		if err != nil {
+			log.WithError(err).Error("Failed to issue API key")
+			renderJSON(w, claimResponse{Message: fmt.Sprintf("Failed to issue API key: %v", err)}, http.StatusInternalServerError)
+			return
+		}
+		log.WithFields(log.Fields{
+			"id":   key.ID,
+			"name": key.Name,
+		}).Info("API key issued by admin")
+		renderJSON(w, adminIssuedAPIKey{APIKey: key, Key: raw}, http.StatusOK)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) handleAdminRevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := path.Base(r.URL.Path)
+	revoked, err := s.apiKeys.Revoke(id)
+	if errors.Is(err, errLegacyAPIKey) {
+		renderJSON(w, claimResponse{Message: fmt.Sprintf("Cannot revoke API key %s: %v", id, err)}, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.WithError(err).Error("Failed to revoke API key")
+		renderJSON(w, claimResponse{Message: fmt.Sprintf("Failed to revoke API key: %v", err)}, http.StatusInternalServerError)
+		return
+	}
+	if !revoked {
+		renderJSON(w, claimResponse{Message: fmt.Sprintf("Unknown API key %s", id)}, http.StatusNotFound)
+		return
+	}
+	log.WithField("id", id).Info("API key revoked by admin")
+	renderJSON(w, claimResponse{Message: fmt.Sprintf("Revoked API key %s", id)}, http.StatusOK)
+}
+
+// handleAdminHistory queries the claim history. Records can be filtered by
+// network, address, ip, outcome and a since and until time, given as RFC 3339
+// or as a duration before now, and are exported as JSON or, with format=csv,
+// as CSV.
+func (s *Server) handleAdminHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.history == nil {
+		renderJSON(w, claimResponse{Message: "The claim history is disabled"}, http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	q := HistoryQuery{
+		Network:  query.Get("network"),
+		Address:  query.Get("address"),
+		ClientIP: query.Get("ip"),
+		Outcome:  query.Get("outcome"),
+		Limit:    defaultHistory,
+	}
+	if value := query.Get("limit"); value != "" {
+		var err error
+		if q.Limit, err = strconv.Atoi(value); err != nil || q.Limit <= 0 {
+			renderJSON(w, claimResponse{Message: "limit must be a positive number"}, http.StatusBadRequest)
+			return
+		}
+		if q.Limit > maxHistory {
+			q.Limit = maxHistory
+		}
+	}
+	for name, t := range map[string]*time.Time{"since": &q.Since, "until": &q.Until} {
+		if value := query.Get(name); value != "" {
+			var err error
+			if *t, err = parseHistoryTime(value); err != nil {
+				renderJSON(w, claimResponse{Message: fmt.Sprintf("%s must be a RFC 3339 time or a duration", name)}, http.StatusBadRequest)
+				return
+			}
+		}
+	}
+	format := query.Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		renderJSON(w, claimResponse{Message: "format must be json or csv"}, http.StatusBadRequest)
+		return
+	}
+
+	records, err := s.history.Query(q)
+	if err != nil {
+		log.WithError(err).Error("Failed to query claim history")
+		renderJSON(w, claimResponse{Message: http.StatusText(http.StatusInternalServerError)}, http.StatusInternalServerError)
+		return
+	}
+	if format != "csv" {
+		if records == nil {
+			records = []ClaimRecord{}
+		}
+		renderJSON(w, records, http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", `attachment; filename="claims.csv"`)
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"time", "network", "address", "client_ip", "user_agent", "token", "amount", "tier", "api_key", "outcome", "reason", "status", "claim_id", "tx_hash"})
+	for _, rec := range records {
+		row := []string{
+			rec.Time.Format(time.RFC3339Nano), rec.Network, rec.Address, rec.ClientIP, rec.UserAgent, rec.Token, rec.Amount,
+			rec.Tier, rec.APIKey, rec.Outcome, rec.Reason, strconv.Itoa(rec.Status), rec.ClaimID, rec.TxHash,
+		}
+		for i := range row {
+			row[i] = csvCell(row[i])
+		}
+		cw.Write(row)
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		log.WithError(err).Warn("Failed to export claim history")
+	}
+}
+
+// csvCell keeps a cell from being evaluated as a formula by spreadsheets,
+// since fields such as the user agent are chosen by clients.
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// parseHistoryTime parses a RFC 3339 time, or a duration before now.
+func parseHistoryTime(value string) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
@@ -0,0 +1,338 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chainflag/eth-faucet/internal/chain"
+)
+
+// APIKey lets a script claim without solving a captcha. Only the hash of
+// the key is kept, so a lost key has to be revoked and issued anew.
+type APIKey struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Hash string `json:"hash"`
+	// RateLimit is the number of claims per hour, 0 for no limit
+	RateLimit int `json:"rate_limit,omitempty"`
+	// MaxAmount caps the native currency payout of a claim in Ethers
+	MaxAmount float64 `json:"max_amount,omitempty"`
+	// DailyBudget caps the Ethers paid out per UTC day on each network
+	DailyBudget float64   `json:"daily_budget,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	// Legacy keys come from the deprecated auth.apikeys setting. They are
+	// not written to the key file and cannot be revoked through the API.
+	Legacy bool `json:"legacy,omitempty"`
+}
+
+// legacyAPIKeyName names the keys listed in auth.apikeys.
+const legacyAPIKeyName = "auth.apikeys"
+
+// errLegacyAPIKey is returned when revoking a key listed in auth.apikeys.
+var errLegacyAPIKey = errors.New("the key is listed in auth.apikeys, remove it from the configuration instead")
+
+// APIKeys holds the issued API keys, read from and written back to a JSON
+// file so keys can also be provisioned by hand.
+type APIKeys struct {
+	mu   sync.RWMutex
+	path string
+	keys []*APIKey
+}
+
+func NewAPIKeys() *APIKeys {
+	return &APIKeys{}
+}
+
+// Load replaces the keys with those in the file at path, which issued and
+// revoked keys are written back to, followed by the legacy keys whose hashes
+// are given. A missing file holds no keys yet, and an empty path clears the
+// keys. The keys are left untouched if the file cannot be read.
+func (k *APIKeys) Load(path string, hashes []string) error {
+	var keys []*APIKey
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if len(data) > 0 {
+			if err := json.Unmarshal(data, &keys); err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+		}
+		ids := make(map[string]bool)
+		for i, key := range keys {
+			key.Hash = strings.ToLower(key.Hash)
+			key.Legacy = false
+			if b, err := hex.DecodeString(key.Hash); err != nil || len(b) != sha256.Size {
+				return fmt.Errorf("%s: key %d: hash is not a hex encoded SHA-256 hash", path, i)
+			}
+			if key.ID == "" {
+				key.ID = key.Hash[:12]
+			}
+			if ids[key.ID] {
+				return fmt.Errorf("%s: duplicate key %s", path, key.ID)
+			}
+			ids[key.ID] = true
+		}
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.path = path
+	k.keys = withLegacyKeys(keys, hashes)
+	return nil
+}
+
+// Reload reads the file at path if it is not the one the keys were loaded
+// from, and replaces the legacy keys with those whose hashes are given. Keys
+// issued since the file was loaded are kept when path is unchanged or empty.
+func (k *APIKeys) Reload(path string, hashes []string) error {
+	k.mu.RLock()
+	loaded := k.path
+	k.mu.RUnlock()
+	if path != "" && path != loaded {
+		return k.Load(path, hashes)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys = withLegacyKeys(k.keys, hashes)
+	return nil
+}
+
+// withLegacyKeys returns the keys that are not legacy, followed by legacy
+// keys for the hashes whose ID is not already taken.
+func withLegacyKeys(keys []*APIKey, hashes []string) []*APIKey {
+	merged := make([]*APIKey, 0, len(keys)+len(hashes))
+	ids := make(map[string]bool)
+	for _, key := range keys {
+		if !key.Legacy {
+			merged = append(merged, key)
+			ids[key.ID] = true
+		}
+	}
+	for _, hash := range hashes {
+		hash = strings.ToLower(hash)
+		if ids[hash[:12]] {
+			continue
+		}
+		ids[hash[:12]] = true
+		merged = append(merged, &APIKey{ID: hash[:12], Name: legacyAPIKeyName, Hash: hash, Legacy: true})
+	}
+	return merged
+}
+
+// Issue creates a key and returns it along with its record. The key itself
+// is not kept and cannot be shown again. No key is issued if the file cannot
+// be written.
+func (k *APIKeys) Issue(name string, rateLimit int, maxAmount, dailyBudget float64) (string, APIKey, error) {
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return "", APIKey{}, err
+	}
+	raw := "fk_" + base64.RawURLEncoding.EncodeToString(secret)
+	hash := hashAPIKey(raw)
+	key := &APIKey{
+		ID:          hash[:12],
+		Name:        name,
+		Hash:        hash,
+		RateLimit:   rateLimit,
+		MaxAmount:   maxAmount,
+		DailyBudget: dailyBudget,
+		CreatedAt:   time.Now().UTC().Truncate(time.Second),
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	keys := append(k.keys[:len(k.keys):len(k.keys)], key)
+	if err := k.save(keys); err != nil {
+		return "", APIKey{}, err
+	}
+	k.keys = keys
+	return raw, *key, nil
+}
+
+// Revoke deletes a key and reports whether it existed. The key is kept if
+// the file cannot be written.
+func (k *APIKeys) Revoke(id string) (bool, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for i, key := range k.keys {
+		if key.ID == id {
+			if key.Legacy {
+				return false, errLegacyAPIKey
+			}
+			keys := append(k.keys[:i:i], k.keys[i+1:]...)
+			if err := k.save(keys); err != nil {
+				return false, err
+			}
+			k.keys = keys
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Lookup returns the record of the key presented by a client.
+func (k *APIKeys) Lookup(raw string) (*APIKey, bool) {
+	hash := hashAPIKey(raw)
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	for _, key := range k.keys {
+		if key.Hash == hash {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+// List returns the keys in the order they were issued.
+func (k *APIKeys) List() []APIKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	keys := make([]APIKey, len(k.keys))
+	for i, key := range k.keys {
+		keys[i] = *key
+	}
+	return keys
+}
+
+// save writes keys to the file of k, if it has one, before they replace
+// the current ones. It must be called with k.mu held.
+func (k *APIKeys) save(keys []*APIKey) error {
+	if k.path == "" {
+		return nil
+	}
+	issued := make([]*APIKey, 0, len(keys))
+	for _, key := range keys {
+		if !key.Legacy {
+			issued = append(issued, key)
+		}
+	}
+	data, err := json.MarshalIndent(issued, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Replace the file in one step, so it is never read half written
+	tmp, err := os.CreateTemp(filepath.Dir(k.path), filepath.Base(k.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), k.path)
+}
+
+// hashAPIKey returns the form API keys are stored in.
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Usage of API keys is counted in the limit store of each network, in gwei
+// for amounts, so it is shared by the replicas sharing the store.
+func apiKeyClaimsKey(key *APIKey) string { return "apikey:" + key.ID + ":claims" }
+func apiKeyPaidKey(key *APIKey) string   { return "apikey:" + key.ID + ":paid" }
+
+func apiKeyHourKey(key *APIKey, t time.Time) string {
+	return "apikey:" + key.ID + ":hour:" + t.UTC().Format("2006-01-02T15")
+}
+
+func apiKeyDayKey(key *APIKey, t time.Time) string {
+	return "apikey:" + key.ID + ":day:" + t.UTC().Format("2006-01-02")
+}
+
+// apiKeyDayTTL keeps the spending of a day until the day after has passed.
+const apiKeyDayTTL = 48 * time.Hour
+
+func weiToGwei(wei *big.Int) int64 {
+	return new(big.Int).Quo(wei, big.NewInt(1e9)).Int64()
+}
+
+func gweiToEther(gwei int64) string {
+	return chain.FromBaseUnits(big.NewInt(gwei), 9)
+}
+
+// spendBudget adds value to what key has paid out on the day of now and
+// reports whether that stays within its daily budget. Nothing is added if it
+// does not.
+func spendBudget(ctx context.Context, store LimitStore, key *APIKey, value *big.Int, now time.Time) (bool, error) {
+	dayKey := apiKeyDayKey(key, now)
+	spent, err := store.Add(ctx, dayKey, weiToGwei(value), apiKeyDayTTL)
+	if err != nil {
+		return false, err
+	}
+	if spent > weiToGwei(chain.EtherToWei(key.DailyBudget)) {
+		_, err := store.Add(ctx, dayKey, -weiToGwei(value), apiKeyDayTTL)
+		return false, err
+	}
+	return true, nil
+}
+
+// refundBudget undoes spendBudget for a claim that was not paid out. now is
+// the time the budget was spent at.
+func refundBudget(ctx context.Context, store LimitStore, key *APIKey, value *big.Int, now time.Time) error {
+	_, err := store.Add(ctx, apiKeyDayKey(key, now), -weiToGwei(value), apiKeyDayTTL)
+	return err
+}
+
+// recordUsage counts a queued claim of key. Token payouts count as claims
+// but not towards the amount paid.
+func recordUsage(ctx context.Context, store LimitStore, key *APIKey, req chain.ClaimRequest) error {
+	if _, err := store.Add(ctx, apiKeyClaimsKey(key), 1, 0); err != nil {
+		return err
+	}
+	if req.Token != nil {
+		return nil
+	}
+	_, err := store.Add(ctx, apiKeyPaidKey(key), weiToGwei(req.Value), 0)
+	return err
+}
+
+// refundUsage undoes recordUsage and spendBudget for a claim of key that was
+// not paid out, whose budget was spent at now.
+func refundUsage(ctx context.Context, store LimitStore, key *APIKey, req chain.ClaimRequest, now time.Time) error {
+	if _, err := store.Add(ctx, apiKeyClaimsKey(key), -1, 0); err != nil {
+		return err
+	}
+	if req.Token != nil {
+		return nil
+	}
+	if _, err := store.Add(ctx, apiKeyPaidKey(key), -weiToGwei(req.Value), 0); err != nil {
+		return err
+	}
+	if key.DailyBudget > 0 {
+		return refundBudget(ctx, store, key, req.Value, now)
+	}
+	return nil
+}
+
+// usageOf reads the usage counters of key.
+func usageOf(ctx context.Context, store LimitStore, key *APIKey) (claims, paid, today int64, err error) {
+	if claims, err = store.Get(ctx, apiKeyClaimsKey(key)); err != nil {
+		return
+	}
+	if paid, err = store.Get(ctx, apiKeyPaidKey(key)); err != nil {
+		return
+	}
+	today, err = store.Get(ctx, apiKeyDayKey(key, time.Now()))
+	return
+}
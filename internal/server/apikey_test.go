@@ -0,0 +1,103 @@
+package server
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAPIKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "apikeys.json")
+	keys := NewAPIKeys()
+	if err := keys.Load(path, nil); err != nil {
+		t.Fatalf("Load() of a missing file: %v", err)
+	}
+
+	ci, issued, err := keys.Issue("ci", 10, 0.5, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bot, _, err := keys.Issue("bot", 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key, ok := keys.Lookup(ci); !ok || key.ID != issued.ID || key.RateLimit != 10 {
+		t.Fatalf("Lookup() = %+v, %v", key, ok)
+	}
+	if _, ok := keys.Lookup("fk_guess"); ok {
+		t.Error("Lookup() accepted an unknown key")
+	}
+
+	// Issued and revoked keys are written back to the file, without the keys themselves
+	if revoked, err := keys.Revoke(issued.ID); err != nil || !revoked {
+		t.Fatalf("Revoke() = %v, %v", revoked, err)
+	}
+	if revoked, _ := keys.Revoke(issued.ID); revoked {
+		t.Error("Revoke() of a revoked key reported it existed")
+	}
+	reloaded := NewAPIKeys()
+	if err := reloaded.Load(path, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := reloaded.Lookup(ci); ok {
+		t.Error("Expected the revoked key to stay revoked after reload")
+	}
+	if key, ok := reloaded.Lookup(bot); !ok || key.Name != "bot" {
+		t.Errorf("Expected the issued key to be reloaded, got %+v", key)
+	}
+	data, _ := os.ReadFile(path)
+	if len(data) == 0 || strings.Contains(string(data), bot) {
+		t.Errorf("Expected the file to hold only hashed keys, got %s", data)
+	}
+
+	if err := os.WriteFile(path, []byte(`[{"name": "bad", "hash": "abc"}]`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := reloaded.Load(path, nil); err == nil {
+		t.Error("Load() accepted a key with an invalid hash")
+	}
+	if _, ok := reloaded.Lookup(bot); !ok {
+		t.Error("Expected the keys to be kept when the file is invalid")
+	}
+	// A key is only issued once it is saved
+	unwritable := NewAPIKeys()
+	if err := unwritable.Load(filepath.Join(t.TempDir(), "missing", "apikeys.json"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := unwritable.Issue("ci", 0, 0, 0); err == nil {
+		t.Error("Issue() succeeded without saving the key")
+	}
+	if keys := unwritable.List(); len(keys) != 0 {
+		t.Errorf("Expected the unsaved key to be dropped, got %+v", keys)
+	}
+}
+
+func TestLegacyAPIKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "apikeys.json")
+	keys := NewAPIKeys()
+	if err := keys.Load(path, []string{strings.ToUpper(hashAPIKey("fk_legacy"))}); err != nil {
+		t.Fatal(err)
+	}
+
+	legacy, ok := keys.Lookup("fk_legacy")
+	if !ok || !legacy.Legacy || legacy.Name != legacyAPIKeyName {
+		t.Fatalf("Lookup() of a legacy key = %+v, %v", legacy, ok)
+	}
+	if _, err := keys.Revoke(legacy.ID); !errors.Is(err, errLegacyAPIKey) {
+		t.Errorf("Revoke() of a legacy key = %v, want %v", err, errLegacyAPIKey)
+	}
+
+	// Legacy keys stay out of the key file
+	if _, _, err := keys.Issue("ci", 0, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), legacy.Hash) {
+		t.Errorf("Expected the key file to leave out legacy keys, got %s", data)
+	}
+	if len(keys.List()) != 2 {
+		t.Errorf("Expected both keys to be listed, got %+v", keys.List())
+	}
+}
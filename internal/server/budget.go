@@ -0,0 +1,124 @@
+package server
+
+import (
+	"context"
+	"math/big"
+	"time"
+
+	"github.com/chainflag/eth-faucet/internal/chain"
+)
+
+// Budget caps the native currency a network pays out per hour and per UTC
+// day, across all claimants. A nil limit leaves its period uncapped.
+type Budget struct {
+	Hourly *big.Int
+	Daily  *big.Int
+}
+
+func (b Budget) Enabled() bool {
+	return b.Hourly != nil || b.Daily != nil
+}
+
+// budgetPeriod is one of the periods a budget is counted over.
+type budgetPeriod struct {
+	name     string
+	limit    *big.Int
+	key      string
+	resetsAt time.Time
+}
+
+// periods returns the capped periods of the budget that contain now.
+func (b Budget) periods(now time.Time) []budgetPeriod {
+	now = now.UTC()
+	var periods []budgetPeriod
+	if b.Hourly != nil {
+		start := now.Truncate(time.Hour)
+		periods = append(periods, budgetPeriod{
+			name:     "hourly",
+			limit:    b.Hourly,
+			key:      "budget:hour:" + start.Format("2006-01-02T15"),
+			resetsAt: start.Add(time.Hour),
+		})
+	}
+	if b.Daily != nil {
+		start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		periods = append(periods, budgetPeriod{
+			name:     "daily",
+			limit:    b.Daily,
+			key:      "budget:day:" + start.Format("2006-01-02"),
+			resetsAt: start.AddDate(0, 0, 1),
+		})
+	}
+	return periods
+}
+
+// Spend adds value to what was paid out in the periods containing now, which
+// are counted in gwei in store so replicas sharing it share the budget. It
+// returns the first period whose limit value would exceed, in which case
+// nothing is added.
+func (b Budget) Spend(ctx context.Context, store LimitStore, value *big.Int, now time.Time) (*budgetPeriod, error) {
+	periods := b.periods(now)
+	for i := range periods {
+		p := &periods[i]
+		spent, err := store.Add(ctx, p.key, weiToGwei(value), 2*p.resetsAt.Sub(now))
+		if err != nil {
+			b.refund(ctx, store, value, periods[:i])
+			return nil, err
+		}
+		if spent > weiToGwei(p.limit) {
+			err := b.refund(ctx, store, value, periods[:i+1])
+			return p, err
+		}
+	}
+	return nil, nil
+}
+
+// Refund undoes Spend for a claim that was not paid out. now is the time
+// the budget was spent at.
+func (b Budget) Refund(ctx context.Context, store LimitStore, value *big.Int, now time.Time) error {
+	return b.refund(ctx, store, value, b.periods(now))
+}
+
+func (b Budget) refund(ctx context.Context, store LimitStore, value *big.Int, periods []budgetPeriod) error {
+	var firstErr error
+	for _, p := range periods {
+		// Nothing is left to refund once the period is over
+		remaining := time.Until(p.resetsAt)
+		if remaining <= 0 {
+			continue
+		}
+		if _, err := store.Add(ctx, p.key, -weiToGwei(value), 2*remaining); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Remaining reports what is left of the budget in the periods containing now.
+func (b Budget) Remaining(ctx context.Context, store LimitStore, now time.Time) (*budgetInfo, error) {
+	if !b.Enabled() {
+		return nil, nil
+	}
+	info := &budgetInfo{}
+	for _, p := range b.periods(now) {
+		spent, err := store.Get(ctx, p.key)
+		if err != nil {
+			return nil, err
+		}
+		remaining := weiToGwei(p.limit) - spent
+		if remaining < 0 {
+			remaining = 0
+		}
+		window := &budgetWindowInfo{
+			Limit:     chain.FromBaseUnits(p.limit, 18),
+			Remaining: gweiToEther(remaining),
+			ResetsAt:  p.resetsAt,
+		}
+		if p.name == "hourly" {
+			info.Hourly = window
+		} else {
+			info.Daily = window
+		}
+	}
+	return info, nil
+}
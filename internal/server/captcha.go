@@ -0,0 +1,150 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/chainflag/eth-faucet/internal/config"
+)
+
+// Default verification endpoints of the captcha providers.
+const (
+	HCaptchaVerifyURL  = "https://api.hcaptcha.com/siteverify"
+	ReCaptchaVerifyURL = "https://www.google.com/recaptcha/api/siteverify"
+	TurnstileVerifyURL = "https://challenges.cloudflare.com/turnstile/v0/siteverify"
+)
+
+// reCaptchaAction is the action the frontend executes reCAPTCHA v3 with.
+const reCaptchaAction = "claim"
+
+// CaptchaProvider verifies the response a captcha widget produced for a client.
+type CaptchaProvider interface {
+	// Type names the widget the frontend has to render
+	Type() string
+	SiteKey() string
+	Verify(ctx context.Context, response, remoteIP string) error
+}
+
+// siteVerifier implements the siteverify protocol shared by hCaptcha,
+// reCAPTCHA and Turnstile: the response is posted as a form along with the
+// secret, and the provider answers whether it is valid.
+type siteVerifier struct {
+	typ       string
+	siteKey   string
+	secret    string
+	verifyURL string
+	// minScore is the lowest score accepted from reCAPTCHA v3
+	minScore float64
+	client   *http.Client
+}
+
+type siteVerifyResponse struct {
+	Success    bool     `json:"success"`
+	Score      *float64 `json:"score"`
+	Action     string   `json:"action"`
+	ErrorCodes []string `json:"error-codes"`
+}
+
+func newSiteVerifier(typ, siteKey, secret, verifyURL, defaultURL string) *siteVerifier {
+	if verifyURL == "" {
+		verifyURL = defaultURL
+	}
+	return &siteVerifier{
+		typ:       typ,
+		siteKey:   siteKey,
+		secret:    secret,
+		verifyURL: verifyURL,
+		client:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func NewHCaptcha(siteKey, secret, verifyURL string) CaptchaProvider {
+	return newSiteVerifier("hcaptcha", siteKey, secret, verifyURL, HCaptchaVerifyURL)
+}
+
+func NewReCaptcha(siteKey, secret, verifyURL string) CaptchaProvider {
+	return newSiteVerifier("recaptcha", siteKey, secret, verifyURL, ReCaptchaVerifyURL)
+}
+
+// NewReCaptchaV3 accepts reCAPTCHA v3 responses scoring at least minScore.
+func NewReCaptchaV3(siteKey, secret, verifyURL string, minScore float64) CaptchaProvider {
+	v := newSiteVerifier("recaptcha-v3", siteKey, secret, verifyURL, ReCaptchaVerifyURL)
+	v.minScore = minScore
+	return v
+}
+
+func NewTurnstile(siteKey, secret, verifyURL string) CaptchaProvider {
+	return newSiteVerifier("turnstile", siteKey, secret, verifyURL, TurnstileVerifyURL)
+}
+
+func (v *siteVerifier) Type() string {
+	return v.typ
+}
+
+func (v *siteVerifier) SiteKey() string {
+	return v.siteKey
+}
+
+func (v *siteVerifier) Verify(ctx context.Context, response, remoteIP string) error {
+	if response == "" {
+		return errors.New("missing captcha response")
+	}
+
+	form := url.Values{"secret": {v.secret}, "response": {response}}
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.verifyURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s verification returned status %d", v.typ, resp.StatusCode)
+	}
+
+	var result siteVerifyResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode %s verification: %w", v.typ, err)
+	}
+	if !result.Success {
+		return fmt.Errorf("%s rejected the response: %s", v.typ, strings.Join(result.ErrorCodes, ", "))
+	}
+	if v.typ == "recaptcha-v3" {
+		if result.Score == nil || *result.Score < v.minScore {
+			return fmt.Errorf("%s score below %g", v.typ, v.minScore)
+		}
+		if result.Action != "" && result.Action != reCaptchaAction {
+			return fmt.Errorf("%s action %q does not match", v.typ, result.Action)
+		}
+	}
+	return nil
+}
+
+// newCaptchaProvider returns the provider configured by cfg, or nil if
+// captchas are disabled.
+func newCaptchaProvider(cfg config.CaptchaConfig) CaptchaProvider {
+	switch cfg.Provider {
+	case "hcaptcha":
+		return NewHCaptcha(cfg.SiteKey, cfg.Secret, cfg.VerifyURL)
+	case "recaptcha":
+		return NewReCaptcha(cfg.SiteKey, cfg.Secret, cfg.VerifyURL)
+	case "recaptcha-v3":
+		return NewReCaptchaV3(cfg.SiteKey, cfg.Secret, cfg.VerifyURL, cfg.MinScore)
+	case "turnstile":
+		return NewTurnstile(cfg.SiteKey, cfg.Secret, cfg.VerifyURL)
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCaptchaProviders(t *testing.T) {
+	// The stub answers with the body posted as the response token
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("secret") != "secret" || r.FormValue("remoteip") != "192.0.2.1" {
+			w.Write([]byte(`{"success": false, "error-codes": ["invalid-input-secret"]}`))
+			return
+		}
+		w.Write([]byte(r.FormValue("response")))
+	}))
+	defer stub.Close()
+
+	tests := []struct {
+		name     string
+		provider CaptchaProvider
+		response string
+		wantErr  bool
+	}{
+		{"hcaptcha", NewHCaptcha("sitekey", "secret", stub.URL), `{"success": true}`, false},
+		{"hcaptcha rejected", NewHCaptcha("sitekey", "secret", stub.URL), `{"success": false}`, true},
+		{"wrong secret", NewTurnstile("sitekey", "other", stub.URL), `{"success": true}`, true},
+		{"turnstile", NewTurnstile("sitekey", "secret", stub.URL), `{"success": true}`, false},
+		{"recaptcha v2", NewReCaptcha("sitekey", "secret", stub.URL), `{"success": true}`, false},
+		{"recaptcha v3", NewReCaptchaV3("sitekey", "secret", stub.URL, 0.5), `{"success": true, "score": 0.9, "action": "claim"}`, false},
+		{"recaptcha v3 low score", NewReCaptchaV3("sitekey", "secret", stub.URL, 0.5), `{"success": true, "score": 0.3, "action": "claim"}`, true},
+		{"recaptcha v3 without score", NewReCaptchaV3("sitekey", "secret", stub.URL, 0.5), `{"success": true}`, true},
+		{"recaptcha v3 other action", NewReCaptchaV3("sitekey", "secret", stub.URL, 0.5), `{"success": true, "score": 0.9, "action": "login"}`, true},
+		{"empty response", NewHCaptcha("sitekey", "secret", stub.URL), "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.provider.Verify(context.Background(), tt.response, "192.0.2.1")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
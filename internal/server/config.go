@@ -1,25 +1,163 @@
 package server
 
+import (
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/chainflag/eth-faucet/internal/chain"
+	"github.com/chainflag/eth-faucet/internal/config"
+)
+
 type Config struct {
-	network         string
-	symbol          string
-	httpPort        int
-	interval        int
-	payout          float64
-	proxyCount      int
-	hcaptchaSiteKey string
-	hcaptchaSecret  string
+	httpPort      int
+	proxyCount    int
+	captcha       config.CaptchaConfig
+	powDifficulty int
+	powSecret     string
+	powTTL        time.Duration
+	admin         config.AdminConfig
+	allowlist     string
+	denylist      string
+	activityName  string
+	authSecret    string
+	keyFile       string
+	apiKeyHashes  []string
+	github        config.GitHubConfig
+	networks      []NetworkConfig
+}
+
+// NetworkConfig holds the settings of one network served by the faucet.
+type NetworkConfig struct {
+	network     string
+	symbol      string
+	interval    int
+	payout      float64
+	tokens      []TokenConfig
+	batch       chain.BatchPolicy
+	funds       chain.FundsPolicy
+	eligibility chain.EligibilityPolicy
+	tiers       []Tier
+	budget      Budget
+}
+
+// TokenConfig describes an ERC-20 token dispensed alongside the native currency.
+type TokenConfig struct {
+	Symbol   string
+	Address  common.Address
+	Decimals uint8
+	Payout   float64
 }
 
-func NewConfig(network, symbol string, httpPort, interval, proxyCount int, payout float64, hcaptchaSiteKey, hcaptchaSecret string) *Config {
+// NewConfig derives the server settings from validated faucet settings.
+func NewConfig(cfg *config.Config) *Config {
+	var batch chain.BatchPolicy
+	if cfg.Batch.Contract != "" {
+		batch = chain.BatchPolicy{
+			Contract: common.HexToAddress(cfg.Batch.Contract),
+			Window:   cfg.Batch.Window,
+			MaxSize:  cfg.Batch.Size,
+		}
+	}
+
+	var funds chain.FundsPolicy
+	if cfg.Faucet.MinBalance > 0 {
+		funds.MinBalance = chain.EtherToWei(cfg.Faucet.MinBalance)
+	}
+	if cfg.Faucet.LowBalance > 0 {
+		funds.ReduceBelow = chain.EtherToWei(cfg.Faucet.LowBalance)
+	}
+
+	eligibility := chain.EligibilityPolicy{
+		MinNonce:    uint64(cfg.Eligibility.MinNonce),
+		MinActivity: uint64(cfg.Eligibility.MinActivity),
+	}
+	if cfg.Eligibility.MaxBalance > 0 {
+		eligibility.MaxBalance = chain.EtherToWei(cfg.Eligibility.MaxBalance)
+	}
+
+	var budget Budget
+	if cfg.Faucet.HourlyBudget > 0 {
+		budget.Hourly = chain.EtherToWei(cfg.Faucet.HourlyBudget)
+	}
+	if cfg.Faucet.DailyBudget > 0 {
+		budget.Daily = chain.EtherToWei(cfg.Faucet.DailyBudget)
+	}
+
+	var networks []NetworkConfig
+	for _, network := range cfg.ResolvedNetworks() {
+		tokens := make([]TokenConfig, len(network.Tokens))
+		for i, token := range network.Tokens {
+			tokens[i] = TokenConfig{
+				Symbol:   strings.ToUpper(token.Symbol),
+				Address:  common.HexToAddress(token.Address),
+				Decimals: token.Decimals,
+				Payout:   token.Amount,
+			}
+		}
+		tiers := make([]Tier, len(cfg.Tiers))
+		for i, tier := range cfg.Tiers {
+			tiers[i] = Tier{
+				Name:     strings.ToLower(tier.Name),
+				Identity: tier.Identity,
+				Payout:   tier.Amount,
+				Interval: *network.Minutes,
+			}
+			if tier.Amount == 0 {
+				tiers[i].Payout = network.Amount
+			}
+			if tier.Minutes != nil && *tier.Minutes > 0 {
+				tiers[i].Interval = *tier.Minutes
+			}
+		}
+		networks = append(networks, NetworkConfig{
+			network:     network.Name,
+			symbol:      network.Symbol,
+			interval:    *network.Minutes,
+			payout:      network.Amount,
+			tokens:      tokens,
+			batch:       batch,
+			funds:       funds,
+			eligibility: eligibility,
+			tiers:       tiers,
+			budget:      budget,
+		})
+	}
+
 	return &Config{
-		network:         network,
-		symbol:          symbol,
-		httpPort:        httpPort,
-		interval:        interval,
-		payout:          payout,
-		proxyCount:      proxyCount,
-		hcaptchaSiteKey: hcaptchaSiteKey,
-		hcaptchaSecret:  hcaptchaSecret,
+		httpPort:      cfg.HTTPPort,
+		proxyCount:    cfg.ProxyCount,
+		captcha:       cfg.ResolvedCaptcha(),
+		powDifficulty: cfg.PoW.Difficulty,
+		powSecret:     cfg.PoW.Secret,
+		powTTL:        cfg.PoW.TTL,
+		admin:         cfg.Admin,
+		allowlist:     cfg.Access.Allowlist,
+		denylist:      cfg.Access.Denylist,
+		activityName:  cfg.Eligibility.ActivityName,
+		authSecret:    cfg.Auth.Secret,
+		keyFile:       cfg.Auth.KeyFile,
+		apiKeyHashes:  cfg.Auth.APIKeys,
+		github:        cfg.Auth.GitHub,
+		networks:      networks,
+	}
+}
+
+func (c *Config) findNetwork(id string) (*NetworkConfig, bool) {
+	for i := range c.networks {
+		if strings.EqualFold(c.networks[i].network, id) {
+			return &c.networks[i], true
+		}
+	}
+	return nil, false
+}
+
+func (c *NetworkConfig) findToken(symbol string) (TokenConfig, bool) {
+	for _, token := range c.tokens {
+		if strings.EqualFold(token.Symbol, symbol) {
+			return token, true
+		}
 	}
+	return TokenConfig{}, false
 }
@@ -2,12 +2,16 @@ package server
 
 import (
 	"bytes"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/chainflag/eth-faucet/internal/chain"
 	"github.com/ethereum/go-ethereum/common"
@@ -15,23 +19,213 @@ import (
 
 type claimRequest struct {
 	Address string `json:"address"`
+	Token   string `json:"token,omitempty"`
 }
 
 type claimResponse struct {
+	// Version is set on responses of the claim API, whose codes clients can
+	// rely on instead of parsing the message
+	Version int    `json:"version,omitempty"`
+	Code    string `json:"code,omitempty"`
 	Message string `json:"msg"`
+	// RetryAfter is the number of seconds to wait before claiming again
+	RetryAfter int    `json:"retry_after,omitempty"`
+	ClaimID    string `json:"claim_id,omitempty"`
+	Position   int    `json:"position,omitempty"`
+	// TxHash is the transaction of the claim, if sent before the response
+	TxHash string `json:"tx_hash,omitempty"`
+	Tier   string `json:"tier,omitempty"`
+}
+
+// claimAPIVersion is the version of the claim response schema. Claims are
+// answered once queued, which is usually before their transaction is sent,
+// so clients get its hash through GET /api/claim/{claim_id} instead.
+const claimAPIVersion = 2
+
+// Codes of the claim API. Unlike the messages, these do not change.
+const (
+	codeQueued            = "queued"
+	codeInvalidRequest    = "invalid_request"
+	codeInvalidAddress    = "invalid_address"
+	codeInvalidAPIKey     = "invalid_api_key"
+	codeDenied            = "denied"
+	codeRateLimited       = "rate_limited"
+	codeCaptchaFailed     = "captcha_failed"
+	codePoWFailed         = "pow_failed"
+	codePaused            = "faucet_paused"
+	codeInsufficientFunds = "insufficient_faucet_funds"
+	codeUnsupportedToken  = "unsupported_token"
+	codeIneligible        = "ineligible"
+	codeBudgetExhausted   = "budget_exhausted"
+	codeQueueFull         = "queue_full"
+	codeTxFailed          = "tx_failed"
+	codeRPCError          = "rpc_error"
+	codeInternalError     = "internal_error"
+	codeClaimNotFound     = "claim_not_found"
+)
+
+type claimStatusResponse struct {
+	ClaimID       string `json:"claim_id,omitempty"`
+	Status        string `json:"status"`
+	Position      int    `json:"position,omitempty"`
+	TxHash        string `json:"tx_hash,omitempty"`
+	BlockNumber   uint64 `json:"block_number,omitempty"`
+	Confirmations uint64 `json:"confirmations,omitempty"`
+	Reason        string `json:"reason,omitempty"`
+	// Code is set to tx_failed once the claim has failed
+	Code string `json:"code,omitempty"`
+}
+
+// newClaimStatusResponse reports a claim by the state of its transaction once
+// it has been sent, and by its place in the queue before that.
+func newClaimStatusResponse(status *chain.ClaimStatus) claimStatusResponse {
+	resp := claimStatusResponse{
+		ClaimID:  status.ID,
+		Status:   string(status.State),
+		Position: status.Position,
+		Reason:   status.Error,
+	}
+	if status.State == chain.ClaimSent {
+		resp.TxHash = status.TxHash.Hex()
+		resp.Status = string(chain.TxPending)
+		if status.Tx != nil {
+			resp.TxHash = status.Tx.Hash.Hex()
+			resp.Status = string(status.Tx.State)
+			resp.BlockNumber = status.Tx.BlockNumber
+			resp.Confirmations = status.Tx.Confirmations
+			resp.Reason = status.Tx.Reason
+		}
+	}
+	if status.State == chain.ClaimFailed || resp.Status == string(chain.TxFailed) {
+		resp.Code = codeTxFailed
+	}
+	return resp
 }
 
 type infoResponse struct {
-	Account         string `json:"account"`
-	Network         string `json:"network"`
-	Payout          string `json:"payout"`
-	Symbol          string `json:"symbol"`
-	HcaptchaSiteKey string `json:"hcaptcha_sitekey,omitempty"`
+	Account         string        `json:"account"`
+	Network         string        `json:"network"`
+	Payout          string        `json:"payout"`
+	Symbol          string        `json:"symbol"`
+	HcaptchaSiteKey string        `json:"hcaptcha_sitekey,omitempty"`
+	CaptchaProvider string        `json:"captcha_provider,omitempty"`
+	CaptchaSiteKey  string        `json:"captcha_sitekey,omitempty"`
+	Tokens          []tokenInfo   `json:"tokens,omitempty"`
+	QueueDepth      int           `json:"queue_depth"`
+	Balance         string        `json:"balance,omitempty"`
+	LowFunds        bool          `json:"low_funds,omitempty"`
+	Networks        []networkInfo `json:"networks,omitempty"`
+	Paused          bool          `json:"paused,omitempty"`
+	PoWDifficulty   int           `json:"pow_difficulty,omitempty"`
+	Tiers           []tierInfo    `json:"tiers,omitempty"`
+	GitHubLogin     bool          `json:"github_login,omitempty"`
+	User            string        `json:"user,omitempty"`
+	Budget          *budgetInfo   `json:"budget,omitempty"`
+}
+
+// budgetInfo reports what is left of the distribution budget, in Ethers.
+type budgetInfo struct {
+	Hourly *budgetWindowInfo `json:"hourly,omitempty"`
+	Daily  *budgetWindowInfo `json:"daily,omitempty"`
+}
+
+type budgetWindowInfo struct {
+	Limit     string    `json:"limit"`
+	Remaining string    `json:"remaining"`
+	ResetsAt  time.Time `json:"resets_at"`
+}
+
+// statsResponse summarizes the claims of a network since the oldest record
+// of the claim history.
+type statsResponse struct {
+	Since           time.Time `json:"since"`
+	Distributed     string    `json:"distributed"`
+	Symbol          string    `json:"symbol"`
+	ClaimsToday     int       `json:"claims_today"`
+	UniqueAddresses int       `json:"unique_addresses"`
+	// AverageLatency is in seconds
+	AverageLatency float64 `json:"average_latency"`
+}
+
+// recentPayout is a payout as shown publicly, with the recipient truncated.
+type recentPayout struct {
+	Address string    `json:"address"`
+	Amount  string    `json:"amount"`
+	Symbol  string    `json:"symbol"`
+	TxHash  string    `json:"tx_hash"`
+	Time    time.Time `json:"time"`
+}
+
+type challengeResponse struct {
+	Challenge  string `json:"challenge"`
+	Difficulty int    `json:"difficulty"`
+}
+
+type networkInfo struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Symbol string `json:"symbol"`
+}
+
+type tierInfo struct {
+	Name     string `json:"name"`
+	Identity string `json:"identity"`
+	Payout   string `json:"payout"`
+	Minutes  int    `json:"minutes"`
+}
+
+type tokenInfo struct {
+	Symbol  string `json:"symbol"`
+	Address string `json:"address"`
+	Payout  string `json:"payout"`
+	Balance string `json:"balance,omitempty"`
+}
+
+// adminClaim is a recent claim as listed by the admin API.
+type adminClaim struct {
+	claimStatusResponse
+	Network   string    `json:"network"`
+	Address   string    `json:"address"`
+	Token     string    `json:"token,omitempty"`
+	Amount    string    `json:"amount"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type adminPayoutRequest struct {
+	Amount float64 `json:"amount"`
+}
+
+type adminAccessRequest struct {
+	Entry string `json:"entry"`
+}
+
+// adminAPIKey is an API key as listed by the admin API, with its usage on
+// one network.
+type adminAPIKey struct {
+	APIKey
+	Claims     int64  `json:"claims"`
+	Paid       string `json:"paid"`
+	SpentToday string `json:"spent_today"`
+}
+
+// adminIssuedAPIKey is the response to issuing an API key.
+type adminIssuedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+type adminAPIKeyRequest struct {
+	Name        string  `json:"name"`
+	RateLimit   int     `json:"rate_limit"`
+	MaxAmount   float64 `json:"max_amount"`
+	DailyBudget float64 `json:"daily_budget"`
 }
 
 type malformedRequest struct {
 	status  int
 	message string
+	// code is the claim API code, if more specific than invalid_request
+	code string
 }
 
 func (mr *malformedRequest) Error() string {
@@ -86,16 +280,41 @@ func decodeJSONBody(r *http.Request, dst interface{}) error {
 	return nil
 }
 
-func readAddress(r *http.Request) (string, error) {
+func readClaimRequest(r *http.Request) (*claimRequest, error) {
 	var claimReq claimRequest
 	if err := decodeJSONBody(r, &claimReq); err != nil {
-		return "", err
+		return nil, err
 	}
 	if !chain.IsValidAddress(claimReq.Address, false) {
-		return "", &malformedRequest{status: http.StatusBadRequest, message: "invalid address"}
+		return nil, &malformedRequest{status: http.StatusBadRequest, message: "invalid address", code: codeInvalidAddress}
+	}
+
+	claimReq.Address = common.HexToAddress(claimReq.Address).Hex()
+	claimReq.Token = strings.ToUpper(strings.TrimSpace(claimReq.Token))
+	return &claimReq, nil
+}
+
+func isValidTxHash(hash string) bool {
+	if !chain.Has0xPrefix(hash) || len(hash) != 2+2*common.HashLength {
+		return false
+	}
+	_, err := hex.DecodeString(hash[2:])
+	return err == nil
+}
+
+// renderClaim writes a response of the claim API, with a Retry-After header
+// for claims refused for a while.
+func renderClaim(w http.ResponseWriter, resp claimResponse, code int) error {
+	resp.Version = claimAPIVersion
+	if resp.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(resp.RetryAfter))
 	}
+	return renderJSON(w, resp, code)
+}
 
-	return common.HexToAddress(claimReq.Address).Hex(), nil
+// retryAfter rounds a wait up to whole seconds.
+func retryAfter(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
 }
 
 func renderJSON(w http.ResponseWriter, v interface{}, code int) error {
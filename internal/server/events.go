@@ -0,0 +1,101 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/chainflag/eth-faucet/internal/chain"
+)
+
+const (
+	// claimEventInterval is how often a streamed claim is checked for progress
+	claimEventInterval = 500 * time.Millisecond
+	// claimStreamDuration ends streams before the write timeout of the server
+	// does. Clients reconnect and resume after the last event they received.
+	claimStreamDuration = 10 * time.Second
+	claimStreamRetry    = time.Second
+)
+
+// eventID identifies the progress a claim status reports, so a reconnecting
+// client is not sent the same event again.
+func (r claimStatusResponse) eventID() string {
+	return fmt.Sprintf("%s:%d:%s:%d", r.Status, r.Position, r.TxHash, r.BlockNumber)
+}
+
+func (r claimStatusResponse) finished() bool {
+	return r.Status == string(chain.TxMined) || r.Status == string(chain.TxFailed)
+}
+
+// streamClaim pushes the progress of a claim as server-sent events, named
+// after the status they report: queued, sending, pending, mined or failed,
+// or replaced when a pending transaction is replaced by one with bumped fees.
+// The stream ends once the claim is mined or has failed.
+func (s *Server) streamClaim(n *network, w http.ResponseWriter, r *http.Request, id string) {
+	status, ok := claimStatusOf(n, id)
+	if !ok {
+		renderClaim(w, claimResponse{Code: codeClaimNotFound, Message: claimNotFound(id)}, http.StatusNotFound)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		renderClaim(w, claimResponse{Code: codeInternalError, Message: "Streaming is not supported"}, http.StatusInternalServerError)
+		return
+	}
+
+	lastID := r.Header.Get("Last-Event-ID")
+	last := strings.Split(lastID, ":")
+	if last[0] == string(chain.TxMined) || last[0] == string(chain.TxFailed) {
+		// Tell reconnecting clients that the stream is over
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	txHash := ""
+	if len(last) == 4 {
+		txHash = last[2]
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", claimStreamRetry.Milliseconds())
+
+	deadline := time.NewTimer(claimStreamDuration)
+	defer deadline.Stop()
+	ticker := time.NewTicker(claimEventInterval)
+	defer ticker.Stop()
+	for {
+		if eventID := status.eventID(); eventID != lastID {
+			event := status.Status
+			if event == string(chain.TxPending) && txHash != "" && status.TxHash != txHash {
+				event = "replaced"
+			}
+			data, err := json.Marshal(status)
+			if err != nil {
+				return
+			}
+			if _, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", eventID, event, data); err != nil {
+				return
+			}
+			flusher.Flush()
+			lastID, txHash = eventID, status.TxHash
+		}
+		if status.finished() {
+			return
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-deadline.C:
+			return
+		case <-ticker.C:
+		}
+		if status, ok = claimStatusOf(n, id); !ok {
+			return
+		}
+	}
+}
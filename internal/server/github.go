@@ -0,0 +1,203 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// GitHub OAuth endpoints.
+const (
+	GitHubAuthorizeURL = "https://github.com/login/oauth/authorize"
+	GitHubTokenURL     = "https://github.com/login/oauth/access_token"
+	GitHubUserURL      = "https://api.github.com/user"
+)
+
+const (
+	sessionCookie = "faucet_session"
+	stateCookie   = "faucet_oauth_state"
+	sessionTTL    = 7 * 24 * time.Hour
+)
+
+// GitHubAuth signs users in through a GitHub OAuth app. Signed in users are
+// remembered by a cookie naming their login, signed by the server.
+type GitHubAuth struct {
+	clientID     string
+	clientSecret string
+	key          []byte
+	authorizeURL string
+	tokenURL     string
+	userURL      string
+	client       *http.Client
+}
+
+func NewGitHubAuth(clientID, clientSecret string, key []byte) *GitHubAuth {
+	return &GitHubAuth{
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		key:          key,
+		authorizeURL: GitHubAuthorizeURL,
+		tokenURL:     GitHubTokenURL,
+		userURL:      GitHubUserURL,
+		client:       &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// User returns the login of the GitHub account the request is signed in
+// with, if its session is valid.
+func (g *GitHubAuth) User(r *http.Request) (string, bool) {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return "", false
+	}
+	parts := strings.Split(cookie.Value, ".")
+	if len(parts) != 3 {
+		return "", false
+	}
+	payload := parts[0] + "." + parts[1]
+	if !hmac.Equal([]byte(parts[2]), []byte(g.sign(payload))) {
+		return "", false
+	}
+	expiry, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || time.Now().Unix() > expiry {
+		return "", false
+	}
+	return parts[0], true
+}
+
+// handleLogin sends the user to GitHub to authorize the app, which returns
+// them to /auth/github/callback.
+func (g *GitHubAuth) handleLogin(w http.ResponseWriter, r *http.Request) {
+	state := make([]byte, 16)
+	if _, err := rand.Read(state); err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     stateCookie,
+		Value:    hex.EncodeToString(state),
+		Path:     "/auth/github",
+		MaxAge:   600,
+		HttpOnly: true,
+		Secure:   isSecure(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	query := url.Values{"client_id": {g.clientID}, "state": {hex.EncodeToString(state)}}
+	http.Redirect(w, r, g.authorizeURL+"?"+query.Encode(), http.StatusFound)
+}
+
+func (g *GitHubAuth) handleCallback(w http.ResponseWriter, r *http.Request) {
+	state, err := r.Cookie(stateCookie)
+	if err != nil || state.Value == "" || !hmac.Equal([]byte(state.Value), []byte(r.URL.Query().Get("state"))) {
+		http.Error(w, "Invalid sign in state, please try again", http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: stateCookie, Path: "/auth/github", MaxAge: -1})
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+	login, err := g.login(ctx, r.URL.Query().Get("code"))
+	if err != nil {
+		log.WithError(err).Warn("GitHub sign in failed")
+		http.Error(w, "GitHub sign in failed, please try again", http.StatusBadGateway)
+		return
+	}
+
+	expiry := time.Now().Add(sessionTTL)
+	payload := fmt.Sprintf("%s.%d", login, expiry.Unix())
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    payload + "." + g.sign(payload),
+		Path:     "/",
+		Expires:  expiry,
+		HttpOnly: true,
+		Secure:   isSecure(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	log.WithField("login", login).Info("User signed in with GitHub")
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// login exchanges an authorization code for the login of the account that
+// granted it.
+func (g *GitHubAuth) login(ctx context.Context, code string) (string, error) {
+	if code == "" {
+		return "", errors.New("missing authorization code")
+	}
+	form := url.Values{"client_id": {g.clientID}, "client_secret": {g.clientSecret}, "code": {code}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	var token struct {
+		AccessToken string `json:"access_token"`
+		Error       string `json:"error"`
+	}
+	if err := g.do(req, &token); err != nil {
+		return "", err
+	}
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("no access token: %s", token.Error)
+	}
+
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, g.userURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	var user struct {
+		Login string `json:"login"`
+	}
+	if err := g.do(req, &user); err != nil {
+		return "", err
+	}
+	if user.Login == "" || strings.Contains(user.Login, ".") {
+		return "", fmt.Errorf("unexpected login %q", user.Login)
+	}
+	return user.Login, nil
+}
+
+func (g *GitHubAuth) do(req *http.Request, v interface{}) error {
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned status %d", req.URL.Host, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (g *GitHubAuth) sign(payload string) string {
+	mac := hmac.New(sha256.New, g.key)
+	mac.Write([]byte("session:" + payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// handleLogout ends the session of the user.
+func handleLogout(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: "/", MaxAge: -1})
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// isSecure reports whether the request reached the faucet, or the proxy in
+// front of it, over HTTPS.
+func isSecure(r *http.Request) bool {
+	return r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https"
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestGitHubAuth(t *testing.T) {
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			if r.FormValue("code") != "good" || r.FormValue("client_secret") != "secret" {
+				w.Write([]byte(`{"error": "bad_verification_code"}`))
+				return
+			}
+			w.Write([]byte(`{"access_token": "token"}`))
+		case "/user":
+			if r.Header.Get("Authorization") != "Bearer token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"login": "octocat"}`))
+		}
+	}))
+	defer stub.Close()
+
+	auth := NewGitHubAuth("client", "secret", []byte("key"))
+	auth.authorizeURL, auth.tokenURL, auth.userURL = stub.URL+"/authorize", stub.URL+"/token", stub.URL+"/user"
+
+	rr := httptest.NewRecorder()
+	auth.handleLogin(rr, httptest.NewRequest("GET", "/auth/github/login", nil))
+	location, err := url.Parse(rr.Header().Get("Location"))
+	if rr.Code != http.StatusFound || err != nil || location.Query().Get("client_id") != "client" {
+		t.Fatalf("Expected redirect to GitHub, got %d to %s", rr.Code, rr.Header().Get("Location"))
+	}
+	state := rr.Result().Cookies()[0]
+
+	tests := []struct {
+		name  string
+		code  string
+		state string
+		want  int
+	}{
+		{name: "forged state", code: "good", state: "forged", want: http.StatusBadRequest},
+		{name: "bad code", code: "bad", state: state.Value, want: http.StatusBadGateway},
+		{name: "signed in", code: "good", state: state.Value, want: http.StatusFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/auth/github/callback?"+url.Values{"code": {tt.code}, "state": {tt.state}}.Encode(), nil)
+			req.AddCookie(state)
+			rr := httptest.NewRecorder()
+			auth.handleCallback(rr, req)
+			if rr.Code != tt.want {
+				t.Fatalf("Expected status %d, but got %d: %s", tt.want, rr.Code, rr.Body.String())
+			}
+			if rr.Code != http.StatusFound {
+				return
+			}
+
+			req = httptest.NewRequest("GET", "/api/info", nil)
+			for _, cookie := range rr.Result().Cookies() {
+				if cookie.Name == sessionCookie {
+					req.AddCookie(cookie)
+				}
+			}
+			if login, ok := auth.User(req); !ok || login != "octocat" {
+				t.Errorf("Expected session of octocat, got %q", login)
+			}
+			if _, ok := NewGitHubAuth("client", "secret", []byte("other")).User(req); ok {
+				t.Error("Expected session signed with another key to be rejected")
+			}
+		})
+	}
+}
@@ -0,0 +1,529 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/params"
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/negroni/v3"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/chainflag/eth-faucet/internal/chain"
+	"github.com/chainflag/eth-faucet/internal/metrics"
+)
+
+// Outcomes of a claim attempt. Queued claims move on to sent or failed once
+// the dispatcher has handled them.
+const (
+	OutcomeQueued   = "queued"
+	OutcomeSent     = "sent"
+	OutcomeFailed   = "failed"
+	OutcomeRejected = "rejected"
+	OutcomeError    = "error"
+)
+
+// ClaimRecord is one claim attempt as kept in the claim history.
+type ClaimRecord struct {
+	Time      time.Time `json:"time"`
+	Network   string    `json:"network"`
+	Address   string    `json:"address,omitempty"`
+	ClientIP  string    `json:"client_ip"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	Token     string    `json:"token,omitempty"`
+	// Amount is the payout in Ethers, or in units of the token
+	Amount  string `json:"amount,omitempty"`
+	Tier    string `json:"tier,omitempty"`
+	APIKey  string `json:"api_key,omitempty"`
+	Outcome string `json:"outcome"`
+	// Reason is the metrics reason of a rejected claim, or the error of a
+	// failed one
+	Reason  string `json:"reason,omitempty"`
+	Status  int    `json:"status"`
+	ClaimID string `json:"claim_id,omitempty"`
+	TxHash  string `json:"tx_hash,omitempty"`
+	// SentAt is when the transaction of the claim was sent, or failed to be
+	SentAt time.Time `json:"sent_at,omitempty"`
+}
+
+// HistoryQuery selects claim records. Zero fields match every record.
+type HistoryQuery struct {
+	Network  string
+	Address  string
+	ClientIP string
+	Outcome  string
+	Since    time.Time
+	Until    time.Time
+	Limit    int
+}
+
+func (q HistoryQuery) matches(rec *ClaimRecord) bool {
+	return (q.Network == "" || strings.EqualFold(rec.Network, q.Network)) &&
+		(q.Address == "" || strings.EqualFold(rec.Address, q.Address)) &&
+		(q.ClientIP == "" || rec.ClientIP == q.ClientIP) &&
+		(q.Outcome == "" || rec.Outcome == q.Outcome)
+}
+
+var (
+	historyBucket = []byte("claims")
+	// claimIDsBucket maps dispatcher claim IDs to their record keys
+	claimIDsBucket = []byte("claim_ids")
+)
+
+// earlyTTL is how long the outcome of a claim is kept waiting for its record.
+const earlyTTL = 10 * time.Minute
+
+// ClaimHistory keeps a record of every claim attempt in a BoltDB file for
+// abuse investigations. Records older than the retention are deleted.
+type ClaimHistory struct {
+	db        *bolt.DB
+	retention time.Duration
+	done      chan struct{}
+	stopped   chan struct{}
+	mu        sync.Mutex
+	// pending holds the outcomes of dispatched claims until the writer
+	// records them, so dispatching never waits on the disk
+	pending []*chain.ClaimStatus
+	wake    chan struct{}
+	// early holds the outcomes of claims dispatched before their record was
+	// added, which happens once the claim request has been answered
+	early map[string]earlyOutcome
+	// statsMu guards tallies, which are kept up to date as records are
+	// added, dispatched and purged
+	statsMu sync.Mutex
+	tallies map[string]*historyTally
+}
+
+type earlyOutcome struct {
+	status *chain.ClaimStatus
+	at     time.Time
+}
+
+// historyTally sums up the accepted claims of a network for its statistics.
+type historyTally struct {
+	distributed *big.Int
+	// days counts the claims per UTC day, and addresses those per recipient
+	days      map[string]int
+	addresses map[string]int
+	// sent and latency sum up the sent claims whose sending time is known
+	sent    int
+	latency time.Duration
+}
+
+// OpenClaimHistory opens the history at path. A zero retention keeps
+// records forever.
+func OpenClaimHistory(path string, retention time.Duration) (*ClaimHistory, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(historyBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(claimIDsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	h := &ClaimHistory{
+		db:        db,
+		retention: retention,
+		done:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+		wake:      make(chan struct{}, 1),
+		early:     make(map[string]earlyOutcome),
+		tallies:   make(map[string]*historyTally),
+	}
+	// Statistics are tallied once here, and then kept up to date
+	err = db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(historyBucket).ForEach(func(_, v []byte) error {
+			var rec ClaimRecord
+			if err := json.Unmarshal(v, &rec); err != nil {
+				return err
+			}
+			h.tally(&rec, 1)
+			return nil
+		})
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	go h.writeLoop()
+	if retention > 0 {
+		go h.purgeLoop(time.Hour)
+	}
+	return h, nil
+}
+
+// Add stores a record. Records are kept in the order of their time, and
+// those of queued claims can later be updated by claim ID.
+func (h *ClaimHistory) Add(rec *ClaimRecord) error {
+	key := make([]byte, 12)
+	binary.BigEndian.PutUint64(key, uint64(rec.Time.UnixNano()))
+	// Tell apart records of the same nanosecond
+	if _, err := rand.Read(key[8:]); err != nil {
+		return err
+	}
+	// Batch coalesces the writes of concurrent claims into one transaction
+	err := h.db.Batch(func(tx *bolt.Tx) error {
+		if rec.ClaimID != "" {
+			// Write transactions are serialized, so a claim dispatched in
+			// the meantime is either here or will find the record
+			h.mu.Lock()
+			if early, ok := h.early[rec.ClaimID]; ok {
+				delete(h.early, rec.ClaimID)
+				applyDispatch(rec, early.status)
+			}
+			h.mu.Unlock()
+			if err := tx.Bucket(claimIDsBucket).Put([]byte(rec.ClaimID), key); err != nil {
+				return err
+			}
+		}
+		value, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(historyBucket).Put(key, value)
+	})
+	if err != nil {
+		if rec.ClaimID != "" {
+			h.mu.Lock()
+			delete(h.early, rec.ClaimID)
+			h.mu.Unlock()
+		}
+		return err
+	}
+	h.statsMu.Lock()
+	h.tally(rec, 1)
+	h.statsMu.Unlock()
+	return nil
+}
+
+// Dispatched queues the outcome of a claim to be recorded in the background.
+// It does not block, so it can be called from the dispatcher.
+func (h *ClaimHistory) Dispatched(status *chain.ClaimStatus) {
+	h.mu.Lock()
+	h.pending = append(h.pending, status)
+	h.mu.Unlock()
+	select {
+	case h.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (h *ClaimHistory) writeLoop() {
+	defer close(h.stopped)
+	for {
+		select {
+		case <-h.done:
+			return
+		case <-h.wake:
+			h.flush()
+		}
+	}
+}
+
+// flush records the pending outcomes of dispatched claims in one
+// transaction.
+func (h *ClaimHistory) flush() {
+	h.mu.Lock()
+	statuses := h.pending
+	h.pending = nil
+	now := time.Now()
+	for id, early := range h.early {
+		if now.Sub(early.at) > earlyTTL {
+			delete(h.early, id)
+		}
+	}
+	h.mu.Unlock()
+	if len(statuses) == 0 {
+		return
+	}
+
+	var before, after []ClaimRecord
+	err := h.db.Update(func(tx *bolt.Tx) error {
+		before, after = before[:0], after[:0]
+		claimIDs, claims := tx.Bucket(claimIDsBucket), tx.Bucket(historyBucket)
+		for _, status := range statuses {
+			key := claimIDs.Get([]byte(status.ID))
+			if key == nil {
+				h.mu.Lock()
+				h.early[status.ID] = earlyOutcome{status: status, at: now}
+				h.mu.Unlock()
+				continue
+			}
+			var rec ClaimRecord
+			if err := json.Unmarshal(claims.Get(key), &rec); err != nil {
+				return err
+			}
+			before = append(before, rec)
+			applyDispatch(&rec, status)
+			value, err := json.Marshal(&rec)
+			if err != nil {
+				return err
+			}
+			if err := claims.Put(key, value); err != nil {
+				return err
+			}
+			after = append(after, rec)
+		}
+		return nil
+	})
+	if err != nil {
+		log.WithError(err).WithField("claims", len(statuses)).Error("Failed to record claim outcomes")
+		return
+	}
+	h.statsMu.Lock()
+	defer h.statsMu.Unlock()
+	for i := range before {
+		h.tally(&before[i], -1)
+		h.tally(&after[i], 1)
+	}
+}
+
+func applyDispatch(rec *ClaimRecord, status *chain.ClaimStatus) {
+	rec.SentAt = status.FinishedAt.UTC()
+	if status.State == chain.ClaimSent {
+		rec.Outcome = OutcomeSent
+		rec.TxHash = status.TxHash.Hex()
+	} else {
+		rec.Outcome = OutcomeFailed
+		rec.Reason = status.Error
+	}
+}
+
+// Query returns the records matching q, newest first.
+func (h *ClaimHistory) Query(q HistoryQuery) ([]ClaimRecord, error) {
+	var records []ClaimRecord
+	err := h.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(historyBucket).Cursor()
+		var k, v []byte
+		if q.Until.IsZero() {
+			k, v = c.Last()
+		} else {
+			seek := make([]byte, 8)
+			binary.BigEndian.PutUint64(seek, uint64(q.Until.UnixNano()))
+			if k, v = c.Seek(seek); k == nil {
+				k, v = c.Last()
+			} else {
+				k, v = c.Prev()
+			}
+		}
+		for ; k != nil; k, v = c.Prev() {
+			if !q.Since.IsZero() && recordTime(k).Before(q.Since) {
+				break
+			}
+			var rec ClaimRecord
+			if err := json.Unmarshal(v, &rec); err != nil {
+				return err
+			}
+			if !q.matches(&rec) {
+				continue
+			}
+			records = append(records, rec)
+			if q.Limit > 0 && len(records) >= q.Limit {
+				break
+			}
+		}
+		return nil
+	})
+	return records, err
+}
+
+// HistoryStats summarizes the claims accepted on a network over the
+// retention of the history.
+type HistoryStats struct {
+	// Since is the time of the oldest record in the history
+	Since time.Time
+	// Distributed is the native currency paid out, in wei
+	Distributed     *big.Int
+	ClaimsToday     int
+	UniqueAddresses int
+	// AverageLatency is the mean time from claiming to sending the
+	// transaction
+	AverageLatency time.Duration
+}
+
+// Stats returns the statistics of network.
+func (h *ClaimHistory) Stats(network string) (*HistoryStats, error) {
+	stats := &HistoryStats{Distributed: new(big.Int)}
+	err := h.db.View(func(tx *bolt.Tx) error {
+		if k, _ := tx.Bucket(historyBucket).Cursor().First(); k != nil {
+			stats.Since = recordTime(k).UTC()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	h.statsMu.Lock()
+	defer h.statsMu.Unlock()
+	t, ok := h.tallies[network]
+	if !ok {
+		return stats, nil
+	}
+	stats.Distributed.Set(t.distributed)
+	stats.ClaimsToday = t.days[time.Now().UTC().Format("2006-01-02")]
+	stats.UniqueAddresses = len(t.addresses)
+	if t.sent > 0 {
+		stats.AverageLatency = t.latency / time.Duration(t.sent)
+	}
+	return stats, nil
+}
+
+// tally adds the record to the statistics of its network, or takes it out
+// with a negative sign. Only queued and sent claims count. It must be called
+// with h.statsMu held, except while the history is opened.
+func (h *ClaimHistory) tally(rec *ClaimRecord, sign int) {
+	if rec.Outcome != OutcomeQueued && rec.Outcome != OutcomeSent {
+		return
+	}
+	t, ok := h.tallies[rec.Network]
+	if !ok {
+		t = &historyTally{distributed: new(big.Int), days: make(map[string]int), addresses: make(map[string]int)}
+		h.tallies[rec.Network] = t
+	}
+	addCount(t.days, rec.Time.UTC().Format("2006-01-02"), sign)
+	addCount(t.addresses, strings.ToLower(rec.Address), sign)
+	if rec.Outcome != OutcomeSent {
+		return
+	}
+	if !rec.SentAt.IsZero() {
+		t.sent += sign
+		t.latency += time.Duration(sign) * rec.SentAt.Sub(rec.Time)
+	}
+	if amount, ok := new(big.Rat).SetString(rec.Amount); ok && rec.Token == "" {
+		wei := amount.Mul(amount, new(big.Rat).SetInt(big.NewInt(params.Ether)))
+		wei.Mul(wei, new(big.Rat).SetInt64(int64(sign)))
+		t.distributed.Add(t.distributed, new(big.Int).Quo(wei.Num(), wei.Denom()))
+	}
+}
+
+func addCount(counts map[string]int, key string, delta int) {
+	if counts[key] += delta; counts[key] <= 0 {
+		delete(counts, key)
+	}
+}
+
+// Close records the outcomes still pending and closes the history.
+func (h *ClaimHistory) Close() error {
+	close(h.done)
+	<-h.stopped
+	h.flush()
+	return h.db.Close()
+}
+
+func (h *ClaimHistory) purgeLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-h.done:
+			return
+		case <-ticker.C:
+			if err := h.purge(time.Now().Add(-h.retention)); err != nil {
+				log.WithError(err).Warn("Failed to purge old claim records")
+			}
+		}
+	}
+}
+
+// purge deletes the records made before cutoff.
+func (h *ClaimHistory) purge(cutoff time.Time) error {
+	var purged []ClaimRecord
+	err := h.db.Update(func(tx *bolt.Tx) error {
+		purged = purged[:0]
+		claimIDs := tx.Bucket(claimIDsBucket)
+		c := tx.Bucket(historyBucket).Cursor()
+		for k, v := c.First(); k != nil && recordTime(k).Before(cutoff); k, v = c.First() {
+			var rec ClaimRecord
+			if json.Unmarshal(v, &rec) == nil {
+				purged = append(purged, rec)
+				if rec.ClaimID != "" {
+					if err := claimIDs.Delete([]byte(rec.ClaimID)); err != nil {
+						return err
+					}
+				}
+			}
+			if err := c.Delete(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	h.statsMu.Lock()
+	defer h.statsMu.Unlock()
+	for i := range purged {
+		h.tally(&purged[i], -1)
+	}
+	return nil
+}
+
+func recordTime(key []byte) time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(key[:8])))
+}
+
+// recordClaim writes every claim made on n to the claim history, if enabled.
+// The handlers further down the chain fill in the record as they learn about
+// the claim.
+func (s *Server) recordClaim(n *network) negroni.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		if s.history == nil {
+			next(w, r)
+			return
+		}
+
+		rec := &ClaimRecord{
+			Time:      time.Now().UTC(),
+			Network:   n.id,
+			ClientIP:  getClientIPFromRequest(s.current().cfg.proxyCount, r),
+			UserAgent: r.UserAgent(),
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), recordContextKey, rec)))
+
+		rec.Status = w.(negroni.ResponseWriter).Status()
+		switch {
+		case rec.Status == http.StatusOK:
+			rec.Outcome = OutcomeQueued
+		case rec.Reason != "":
+			rec.Outcome = OutcomeRejected
+		default:
+			rec.Outcome = OutcomeError
+		}
+		if err := s.history.Add(rec); err != nil {
+			log.WithError(err).Error("Failed to record claim")
+		}
+	}
+}
+
+// claimRecord returns the history record of the claim being handled, or nil
+// if the history is disabled.
+func claimRecord(r *http.Request) *ClaimRecord {
+	rec, _ := r.Context().Value(recordContextKey).(*ClaimRecord)
+	return rec
+}
+
+// rejectClaim counts a refused claim under reason, and notes the reason in
+// the history record of the claim.
+func rejectClaim(r *http.Request, reason string) {
+	metrics.ClaimsRejected.WithLabelValues(reason).Inc()
+	if rec := claimRecord(r); rec != nil {
+		rec.Reason = reason
+	}
+}
@@ -0,0 +1,194 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/chainflag/eth-faucet/internal/chain"
+	"github.com/chainflag/eth-faucet/internal/config"
+)
+
+func TestClaimHistory(t *testing.T) {
+	history, err := OpenClaimHistory(filepath.Join(t.TempDir(), "history.db"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer history.Close()
+
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	records := []*ClaimRecord{
+		{Time: start, Network: "sepolia", Address: "0xA", ClientIP: "192.0.2.1", Outcome: OutcomeQueued, ClaimID: "early"},
+		{Time: start.Add(time.Minute), Network: "sepolia", Address: "0xB", ClientIP: "192.0.2.1", Outcome: OutcomeRejected, Reason: "rate_limited"},
+		{Time: start.Add(2 * time.Minute), Network: "holesky", Address: "0xA", ClientIP: "192.0.2.2", Outcome: OutcomeQueued, ClaimID: "late"},
+	}
+	// A claim can be dispatched before its record is added
+	history.Dispatched(&chain.ClaimStatus{ID: "early", State: chain.ClaimSent, TxHash: common.Hash{1}})
+	history.flush()
+	for _, rec := range records {
+		if err := history.Add(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	history.Dispatched(&chain.ClaimStatus{ID: "late", State: chain.ClaimFailed, Error: "nonce too low"})
+	history.flush()
+
+	tests := []struct {
+		name  string
+		query HistoryQuery
+		want  []string
+	}{
+		{name: "all", want: []string{"failed", "rejected", "sent"}},
+		{name: "address", query: HistoryQuery{Address: "0xa"}, want: []string{"failed", "sent"}},
+		{name: "ip", query: HistoryQuery{ClientIP: "192.0.2.1"}, want: []string{"rejected", "sent"}},
+		{name: "network", query: HistoryQuery{Network: "Sepolia", Outcome: OutcomeRejected}, want: []string{"rejected"}},
+		{name: "time range", query: HistoryQuery{Since: start.Add(time.Second), Until: start.Add(2 * time.Minute)}, want: []string{"rejected"}},
+		{name: "limit", query: HistoryQuery{Limit: 1}, want: []string{"failed"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := history.Query(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var outcomes []string
+			for _, rec := range records {
+				outcomes = append(outcomes, rec.Outcome)
+			}
+			if strings.Join(outcomes, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Query() outcomes = %v, want %v", outcomes, tt.want)
+			}
+		})
+	}
+	if records, _ := history.Query(HistoryQuery{Outcome: OutcomeSent}); len(records) != 1 || records[0].TxHash != (common.Hash{1}).Hex() {
+		t.Errorf("Expected the transaction of the sent claim to be recorded, got %+v", records)
+	}
+
+	// Failed claims are taken out of the statistics, and purged ones too
+	for network, want := range map[string]int{"sepolia": 1, "holesky": 0} {
+		if stats, _ := history.Stats(network); stats.UniqueAddresses != want {
+			t.Errorf("Expected %d addresses on %s, got %d", want, network, stats.UniqueAddresses)
+		}
+	}
+	if err := history.purge(start.Add(90 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if records, _ := history.Query(HistoryQuery{}); len(records) != 1 {
+		t.Errorf("Expected only the record after the cutoff to remain, got %d", len(records))
+	}
+	if stats, _ := history.Stats("sepolia"); stats.UniqueAddresses != 0 || !stats.Since.Equal(start.Add(2*time.Minute)) {
+		t.Errorf("Expected the purged records to leave the statistics, got %+v", stats)
+	}
+
+	// Outcomes of claims that are never recorded are eventually dropped
+	history.Dispatched(&chain.ClaimStatus{ID: "orphan", State: chain.ClaimSent})
+	history.flush()
+	history.mu.Lock()
+	history.early["orphan"] = earlyOutcome{at: time.Now().Add(-earlyTTL - time.Second)}
+	history.mu.Unlock()
+	history.flush()
+	if _, ok := history.early["orphan"]; ok {
+		t.Error("Expected the outcome of the unrecorded claim to expire")
+	}
+}
+
+func TestAdminHistory(t *testing.T) {
+	history, err := OpenClaimHistory(filepath.Join(t.TempDir(), "history.db"), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer history.Close()
+	cfg := &Config{
+		admin:    config.AdminConfig{Token: "secret"},
+		networks: []NetworkConfig{{network: "testnet", symbol: "ETH", payout: 1, interval: 60}},
+	}
+	server := NewServer(map[string]chain.TxBuilder{"testnet": new(MockTxBuilder)}, nil, NewMemoryStore(), history, cfg)
+	router := server.setupRouter()
+
+	address := "0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045"
+	// The second user agent would be evaluated as a formula by spreadsheets
+	agents := []string{"claim-script/1.0", `=HYPERLINK("http://example.com")`}
+	for i, want := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		req := httptest.NewRequest("POST", "/api/claim", strings.NewReader(`{"address": "`+address+`"}`))
+		req.RemoteAddr = fmt.Sprintf("192.0.2.%d:1234", i+1)
+		req.Header.Set("User-Agent", agents[i])
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != want {
+			t.Fatalf("Expected status %d, but got %d: %s", want, rr.Code, rr.Body.String())
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/admin/history?format=csv&address="+address, nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	rows, err := csv.NewReader(rr.Body).ReadAll()
+	if rr.Code != http.StatusOK || err != nil || len(rows) != 3 {
+		t.Fatalf("Expected a header and two records, got %d: %v", rr.Code, rows)
+	}
+	rejected, queued := rows[1], rows[2]
+	if rejected[3] != "192.0.2.2" || rejected[4] != "'"+agents[1] || rejected[9] != OutcomeRejected || rejected[10] != "rate_limited" || rejected[11] != "429" {
+		t.Errorf("Unexpected record of the rejected claim %v", rejected)
+	}
+	if queued[4] != agents[0] || queued[6] != "1" || queued[7] != anonymousTier || queued[9] != OutcomeQueued || queued[12] == "" {
+		t.Errorf("Unexpected record of the queued claim %v", queued)
+	}
+}
+
+func TestStatsAndRecent(t *testing.T) {
+	history, err := OpenClaimHistory(filepath.Join(t.TempDir(), "history.db"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer history.Close()
+	server := NewServer(map[string]chain.TxBuilder{"testnet": new(MockTxBuilder)}, nil, NewMemoryStore(), history, &Config{
+		networks: []NetworkConfig{{network: "testnet", symbol: "ETH", payout: 1}},
+	})
+
+	now := time.Now().UTC()
+	records := []*ClaimRecord{
+		{Time: now.Add(-time.Minute), Network: "testnet", Address: "0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045", Amount: "0.5", Outcome: OutcomeSent, TxHash: "0x01", SentAt: now.Add(-time.Minute + 2*time.Second)},
+		{Time: now.Add(-time.Minute + time.Second), Network: "testnet", Address: "0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045", Token: "usdc", Amount: "10", Outcome: OutcomeSent, TxHash: "0x02", SentAt: now.Add(-time.Minute + 4*time.Second)},
+		{Time: now, Network: "testnet", Address: "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", Amount: "1", Outcome: OutcomeQueued},
+		{Time: now, Network: "testnet", Address: "0x1000000000000000000000000000000000000001", Outcome: OutcomeRejected},
+		{Time: now, Network: "other", Address: "0x1000000000000000000000000000000000000002", Amount: "1", Outcome: OutcomeSent},
+	}
+	for _, rec := range records {
+		if err := history.Add(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	server.handleStats(server.networks[0]).ServeHTTP(rr, httptest.NewRequest("GET", "/api/stats", nil))
+	var stats statsResponse
+	json.Unmarshal(rr.Body.Bytes(), &stats)
+	if stats.Distributed != "0.5" || stats.UniqueAddresses != 2 || stats.AverageLatency != 2.5 {
+		t.Errorf("Unexpected stats %s", rr.Body.String())
+	}
+	// Claims made just before midnight UTC are counted on the day before
+	want := 3
+	if now.Add(-time.Minute).Day() != now.Day() {
+		want = 1
+	}
+	if stats.ClaimsToday != want {
+		t.Errorf("Expected %d claims today, got %d", want, stats.ClaimsToday)
+	}
+
+	rr = httptest.NewRecorder()
+	server.handleRecent(server.networks[0]).ServeHTTP(rr, httptest.NewRequest("GET", "/api/recent?limit=5", nil))
+	var payouts []recentPayout
+	json.Unmarshal(rr.Body.Bytes(), &payouts)
+	if len(payouts) != 2 || payouts[0].Symbol != "USDC" || payouts[1].Address != "0xd8dA…6045" || payouts[1].TxHash != "0x01" {
+		t.Errorf("Unexpected recent payouts %s", rr.Body.String())
+	}
+}
@@ -7,88 +7,210 @@ import (
 	"net"
 	"net/http"
 	"strings"
-	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/jellydator/ttlcache/v2"
-	"github.com/kataras/hcaptcha"
 	log "github.com/sirupsen/logrus"
 	"github.com/urfave/negroni/v3"
+
+	"github.com/chainflag/eth-faucet/internal/metrics"
 )
 
 type contextKey int
 
-const addressContextKey contextKey = iota
+const (
+	addressContextKey contextKey = iota
+	tokenContextKey
+	identityContextKey
+	tierContextKey
+	recordContextKey
+	refundContextKey
+)
 
+// Limiter enforces the cooldown between claims of the same address or IP.
+// Claims matching the denylist are refused outright, and those matching the
+// allowlist skip the cooldown. Claims paid at a tier wait for the cooldown
+// of their tier instead.
 type Limiter struct {
-	mutex      sync.Mutex
-	cache      *ttlcache.Cache
+	store      LimitStore
 	proxyCount int
-	ttl        time.Duration
+	ttl        int64
+	tiers      atomic.Value
+	allow      *AccessList
+	deny       *AccessList
 }
 
-func NewLimiter(proxyCount int, ttl time.Duration) *Limiter {
-	cache := ttlcache.NewCache()
-	cache.SkipTTLExtensionOnHit(true)
-	return &Limiter{
-		cache:      cache,
+func NewLimiter(store LimitStore, proxyCount int, ttl time.Duration, allow, deny *AccessList) *Limiter {
+	l := &Limiter{
+		store:      store,
 		proxyCount: proxyCount,
-		ttl:        ttl,
+		ttl:        int64(ttl),
+		allow:      allow,
+		deny:       deny,
 	}
+	l.tiers.Store([]Tier(nil))
+	return l
+}
+
+// SetTTL changes the cooldown of claims made from now on. Existing records
+// keep the TTL they were created with.
+func (l *Limiter) SetTTL(ttl time.Duration) {
+	atomic.StoreInt64(&l.ttl, int64(ttl))
+}
+
+// SetTiers changes the tiers claims made from now on are matched against.
+func (l *Limiter) SetTiers(tiers []Tier) {
+	l.tiers.Store(tiers)
 }
 
 func (l *Limiter) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
-	address, err := readAddress(r)
+	claimReq, err := readClaimRequest(r)
 	if err != nil {
 		var mr *malformedRequest
 		if errors.As(err, &mr) {
-			renderJSON(w, claimResponse{Message: mr.message}, mr.status)
+			rejectClaim(r, metrics.ReasonMalformed)
+			code := mr.code
+			if code == "" {
+				code = codeInvalidRequest
+			}
+			renderClaim(w, claimResponse{Code: code, Message: mr.message}, mr.status)
 		} else {
-			renderJSON(w, claimResponse{Message: http.StatusText(http.StatusInternalServerError)}, http.StatusInternalServerError)
+			renderClaim(w, claimResponse{Code: codeInternalError, Message: http.StatusText(http.StatusInternalServerError)}, http.StatusInternalServerError)
 		}
 		return
 	}
 
-	r = r.WithContext(context.WithValue(r.Context(), addressContextKey, address))
+	address := claimReq.Address
+	if rec := claimRecord(r); rec != nil {
+		rec.Address, rec.Token = address, claimReq.Token
+	}
+	refund := &claimRefund{}
+	ctx := context.WithValue(r.Context(), addressContextKey, address)
+	ctx = context.WithValue(ctx, tokenContextKey, claimReq.Token)
+	ctx = context.WithValue(ctx, refundContextKey, refund)
+	r = r.WithContext(ctx)
 
-	if l.ttl <= 0 {
+	clientIP := getClientIPFromRequest(l.proxyCount, r)
+	if l.deny.Contains(address, clientIP) {
+		log.WithFields(log.Fields{
+			"address":  address,
+			"clientIP": clientIP,
+		}).Warn("Refusing claim from denylist")
+		rejectClaim(r, metrics.ReasonDenied)
+		renderClaim(w, claimResponse{Code: codeDenied, Message: "This address or IP is not allowed to claim"}, http.StatusForbidden)
+		return
+	}
+
+	id, _ := r.Context().Value(identityContextKey).(identity)
+	id.Allowlisted = l.allow.Contains(address, clientIP)
+	tier := matchTier(l.tiers.Load().([]Tier), id)
+	r = r.WithContext(context.WithValue(r.Context(), tierContextKey, tier))
+
+	if key := id.APIKey; key != nil && key.RateLimit > 0 {
+		now := time.Now()
+		hourKey := apiKeyHourKey(key, now)
+		count, err := l.store.Add(r.Context(), hourKey, 1, 2*time.Hour)
+		if err != nil {
+			log.WithError(err).Error("Failed to apply API key rate limit")
+			renderClaim(w, claimResponse{Code: codeInternalError, Message: http.StatusText(http.StatusInternalServerError)}, http.StatusInternalServerError)
+			return
+		}
+		// Failed and refused claims do not count against the rate limit
+		defer func() {
+			if count <= int64(key.RateLimit) && w.(negroni.ResponseWriter).Status() == http.StatusOK {
+				return
+			}
+			if _, err := l.store.Add(context.Background(), hourKey, -1, 0); err != nil {
+				log.WithError(err).Error("Failed to release API key rate limit")
+			}
+		}()
+		refund.add(func() {
+			if _, err := l.store.Add(context.Background(), hourKey, -1, 2*time.Hour); err != nil {
+				log.WithError(err).Error("Failed to release API key rate limit")
+			}
+		})
+		if count > int64(key.RateLimit) {
+			rejectClaim(r, metrics.ReasonRateLimited)
+			errMsg := fmt.Sprintf("The API key has exceeded its rate limit of %d claims per hour", key.RateLimit)
+			renderClaim(w, claimResponse{
+				Code:       codeRateLimited,
+				Message:    errMsg,
+				RetryAfter: retryAfter(now.Truncate(time.Hour).Add(time.Hour).Sub(now)),
+			}, http.StatusTooManyRequests)
+			return
+		}
+	}
+
+	ttl := time.Duration(atomic.LoadInt64(&l.ttl))
+	if tier != nil && tier.Interval > 0 {
+		ttl = time.Duration(tier.Interval) * time.Minute
+	}
+	if ttl <= 0 || id.Allowlisted {
 		next.ServeHTTP(w, r)
 		return
 	}
 
-	clientIP := getClientIPFromRequest(l.proxyCount, r)
-	l.mutex.Lock()
-	if l.limitByKey(w, address) || l.limitByKey(w, clientIP) {
-		l.mutex.Unlock()
+	// Each token has its own cooldown, so claiming one does not block the others
+	addressKey, ipKey := address, clientIP
+	if claimReq.Token != "" {
+		addressKey = claimReq.Token + ":" + address
+		ipKey = claimReq.Token + ":" + clientIP
+	}
+	keys := []string{addressKey, ipKey}
+	if id.APIKey != nil {
+		// Scripts claim for many addresses from a few IPs, and are held to
+		// the rate limit of their key instead
+		keys = keys[:1]
+	}
+	if id.GitHub != "" {
+		// A signed in account cannot claim again from other addresses and IPs
+		githubKey := "gh:" + strings.ToLower(id.GitHub)
+		if claimReq.Token != "" {
+			githubKey = claimReq.Token + ":" + githubKey
+		}
+		keys = append(keys, githubKey)
+	}
+	remaining, ok, err := l.store.Reserve(r.Context(), keys, ttl)
+	if err != nil {
+		log.WithError(err).Error("Failed to apply rate limit")
+		renderClaim(w, claimResponse{Code: codeInternalError, Message: http.StatusText(http.StatusInternalServerError)}, http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		rejectClaim(r, metrics.ReasonRateLimited)
+		errMsg := fmt.Sprintf("You have exceeded the rate limit. Please wait %s before you try again", remaining.Round(time.Second))
+		renderClaim(w, claimResponse{Code: codeRateLimited, Message: errMsg, RetryAfter: retryAfter(remaining)}, http.StatusTooManyRequests)
 		return
 	}
-	l.cache.SetWithTTL(address, true, l.ttl)
-	l.cache.SetWithTTL(clientIP, true, l.ttl)
-	l.mutex.Unlock()
 
+	// If the claim fails, remove limit records to allow retry
+	release := func() {
+		if err := l.store.Remove(context.Background(), keys...); err != nil {
+			log.WithError(err).Error("Failed to remove rate limit records")
+		}
+	}
+	refund.add(release)
 	next.ServeHTTP(w, r)
 	status := w.(negroni.ResponseWriter).Status()
 	if status != http.StatusOK {
-		// If request fails, remove limit records to allow retry
-		l.mutex.Lock()
-		l.cache.Remove(address)
-		l.cache.Remove(clientIP)
-		l.mutex.Unlock()
+		release()
 		return
 	}
 	log.WithFields(log.Fields{
 		"address":  address,
+		"token":    claimReq.Token,
 		"clientIP": clientIP,
 	}).Info("Request succeeded, rate limit applied")
 }
 
-func (l *Limiter) limitByKey(w http.ResponseWriter, key string) bool {
-	if _, ttl, err := l.cache.GetWithTTL(key); err == nil {
-		errMsg := fmt.Sprintf("You have exceeded the rate limit. Please wait %s before you try again", ttl.Round(time.Second))
-		renderJSON(w, claimResponse{Message: errMsg}, http.StatusTooManyRequests)
-		return true
+// Clear removes the rate limit records of an address or IP, including those
+// of the given tokens, so it can claim again right away.
+func (l *Limiter) Clear(ctx context.Context, key string, tokens []string) error {
+	keys := []string{key}
+	for _, token := range tokens {
+		keys = append(keys, token+":"+key)
 	}
-	return false
+	return l.store.Remove(ctx, keys...)
 }
 
 func getClientIPFromRequest(proxyCount int, r *http.Request) string {
@@ -112,20 +234,29 @@ func getClientIPFromRequest(proxyCount int, r *http.Request) string {
 	return remoteIP
 }
 
+// Captcha verifies the captcha response sent along with a claim in the
+// X-Captcha-Response header, or h-captcha-response for older clients.
 type Captcha struct {
-	client *hcaptcha.Client
+	provider   CaptchaProvider
+	proxyCount int
 }
 
-func NewCaptcha(hcaptchaSiteKey, hcaptchaSecret string) *Captcha {
-	client := hcaptcha.New(hcaptchaSecret)
-	client.SiteKey = hcaptchaSiteKey
-	return &Captcha{client: client}
+func NewCaptcha(provider CaptchaProvider, proxyCount int) *Captcha {
+	return &Captcha{provider: provider, proxyCount: proxyCount}
 }
 
 func (c *Captcha) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
-	response := c.client.VerifyToken(r.Header.Get("h-captcha-response"))
-	if !response.Success {
-		renderJSON(w, claimResponse{Message: "Captcha verification failed, please try again"}, http.StatusTooManyRequests)
+	response := r.Header.Get("X-Captcha-Response")
+	if response == "" {
+		response = r.Header.Get("h-captcha-response")
+	}
+	if err := c.provider.Verify(r.Context(), response, getClientIPFromRequest(c.proxyCount, r)); err != nil {
+		log.WithFields(log.Fields{
+			"provider": c.provider.Type(),
+			"error":    err,
+		}).Debug("Captcha rejected")
+		rejectClaim(r, metrics.ReasonCaptchaFailed)
+		renderClaim(w, claimResponse{Code: codeCaptchaFailed, Message: "Captcha verification failed, please try again"}, http.StatusTooManyRequests)
 		return
 	}
 
@@ -0,0 +1,183 @@
+package server
+
+import (
+	"context"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/chainflag/eth-faucet/internal/chain"
+)
+
+// network is a chain served by the faucet, with its own funding accounts,
+// claim queue and rate limits.
+type network struct {
+	id         string
+	txBuilder  chain.TxBuilder
+	checker    *chain.EligibilityChecker
+	dispatcher *chain.Dispatcher
+	balances   *chain.BalanceWatcher
+	limiter    *Limiter
+	store      LimitStore
+	settings   atomic.Value
+	paused     int32
+	// refunds undo what queued claims were charged, should they fail
+	refundMu sync.Mutex
+	refunds  map[string]func()
+}
+
+// networkSettings are the reloadable settings of a network.
+type networkSettings struct {
+	cfg       *NetworkConfig
+	payoutWei *big.Int
+}
+
+func newNetwork(builder chain.TxBuilder, checker *chain.EligibilityChecker, store LimitStore, proxyCount int, allow, deny *AccessList, cfg *NetworkConfig) *network {
+	n := &network{
+		id:         strings.ToLower(cfg.network),
+		txBuilder:  builder,
+		checker:    checker,
+		dispatcher: chain.NewDispatcher(builder, claimQueueSize, cfg.batch),
+		balances:   chain.NewBalanceWatcher(builder, balanceInterval),
+		limiter:    NewLimiter(store, proxyCount, time.Duration(cfg.interval)*time.Minute, allow, deny),
+		store:      store,
+		refunds:    make(map[string]func()),
+	}
+	n.dispatcher.OnUpdate(n.settle)
+	n.reload(cfg)
+	return n
+}
+
+func (n *network) current() *networkSettings {
+	return n.settings.Load().(*networkSettings)
+}
+
+func (n *network) reload(cfg *NetworkConfig) {
+	n.settings.Store(&networkSettings{
+		cfg:       cfg,
+		payoutWei: chain.EtherToWei(cfg.payout),
+	})
+	n.limiter.SetTTL(time.Duration(cfg.interval) * time.Minute)
+	n.limiter.SetTiers(cfg.tiers)
+}
+
+// setPayout overrides the native currency payout until the next reload.
+func (n *network) setPayout(payout float64) {
+	cfg := *n.current().cfg
+	cfg.payout = payout
+	n.settings.Store(&networkSettings{
+		cfg:       &cfg,
+		payoutWei: chain.EtherToWei(payout),
+	})
+}
+
+func (n *network) setPaused(paused bool) {
+	var value int32
+	if paused {
+		value = 1
+	}
+	atomic.StoreInt32(&n.paused, value)
+}
+
+func (n *network) isPaused() bool {
+	return atomic.LoadInt32(&n.paused) == 1
+}
+
+// run starts the background work of the network. wg is done once the
+// dispatcher has stopped and failed the claims still queued.
+func (n *network) run(ctx context.Context, wg *sync.WaitGroup) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		n.dispatcher.Run(ctx)
+	}()
+	go n.balances.Run(ctx)
+}
+
+// enqueue queues a claim, keeping refund to be called if the claim fails.
+func (n *network) enqueue(req chain.ClaimRequest, refund func()) (string, int, error) {
+	// Hold the lock so the claim cannot be settled before its refund is kept
+	n.refundMu.Lock()
+	defer n.refundMu.Unlock()
+	id, position, err := n.dispatcher.Enqueue(req)
+	if err == nil {
+		n.refunds[id] = refund
+	}
+	return id, position, err
+}
+
+// settle refunds a dispatched claim that failed.
+func (n *network) settle(status *chain.ClaimStatus) {
+	n.refundMu.Lock()
+	refund := n.refunds[status.ID]
+	delete(n.refunds, status.ID)
+	n.refundMu.Unlock()
+	if refund != nil && status.State == chain.ClaimFailed {
+		refund()
+	}
+}
+
+// claimRefund collects what a claim was charged against rate limits, to be
+// undone if the claim fails after it was queued.
+type claimRefund struct {
+	fns []func()
+}
+
+func (c *claimRefund) add(fn func()) {
+	c.fns = append(c.fns, fn)
+}
+
+func (c *claimRefund) run() {
+	for i := len(c.fns) - 1; i >= 0; i-- {
+		c.fns[i]()
+	}
+}
+
+// currentPayout returns the native currency payout of tier, or of anonymous
+// claims if tier is nil, reduced according to the funds policy once the
+// faucet balance runs low.
+func (n *network) currentPayout(st *networkSettings, tier *Tier) *big.Int {
+	payout := st.payoutWei
+	if tier != nil {
+		payout = chain.EtherToWei(tier.Payout)
+	}
+	balance, ok := n.balances.Balance()
+	if !ok {
+		return new(big.Int).Set(payout)
+	}
+	return st.cfg.funds.Payout(payout, balance)
+}
+
+func (n *network) tokenInfos(ctx context.Context, tokens []TokenConfig) []tokenInfo {
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	infos := make([]tokenInfo, 0, len(tokens))
+	for _, token := range tokens {
+		info := tokenInfo{
+			Symbol:  token.Symbol,
+			Address: token.Address.Hex(),
+			Payout:  strconv.FormatFloat(token.Payout, 'f', -1, 64),
+		}
+		if balance, err := n.txBuilder.TokenBalance(ctx, token.Address); err != nil {
+			log.WithFields(log.Fields{
+				"error":   err,
+				"network": n.id,
+				"token":   token.Symbol,
+			}).Warn("Failed to fetch token balance")
+		} else {
+			info.Balance = chain.FromBaseUnits(balance, token.Decimals)
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
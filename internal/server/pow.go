@@ -0,0 +1,119 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/bits"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/chainflag/eth-faucet/internal/metrics"
+)
+
+var errInvalidChallenge = errors.New("invalid challenge")
+
+// ProofOfWork asks clients to solve a challenge signed by the server before
+// they can claim. A solution is a nonce for which the SHA-256 hash of
+// "<challenge>:<nonce>" starts with the given number of zero bits. Every
+// challenge expires after ttl and can only be used once.
+type ProofOfWork struct {
+	key        []byte
+	difficulty int
+	ttl        time.Duration
+	used       LimitStore
+}
+
+func NewProofOfWork(key []byte, difficulty int, ttl time.Duration, used LimitStore) *ProofOfWork {
+	return &ProofOfWork{
+		key:        key,
+		difficulty: difficulty,
+		ttl:        ttl,
+		used:       used,
+	}
+}
+
+// Challenge issues a new challenge at the current difficulty.
+func (p *ProofOfWork) Challenge() (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	payload := fmt.Sprintf("%s.%d.%d", hex.EncodeToString(salt), time.Now().Add(p.ttl).Unix(), p.difficulty)
+	return payload + "." + p.sign(payload), nil
+}
+
+// Verify checks that nonce solves challenge and marks the challenge as used.
+func (p *ProofOfWork) Verify(ctx context.Context, challenge, nonce string) error {
+	parts := strings.Split(challenge, ".")
+	if len(parts) != 4 {
+		return errInvalidChallenge
+	}
+	payload := strings.Join(parts[:3], ".")
+	if !hmac.Equal([]byte(parts[3]), []byte(p.sign(payload))) {
+		return errInvalidChallenge
+	}
+	expiry, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return errInvalidChallenge
+	}
+	remaining := time.Until(time.Unix(expiry, 0))
+	if remaining <= 0 {
+		return errors.New("challenge expired")
+	}
+	// The difficulty is signed, so challenges issued before a change stay valid
+	difficulty, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return errInvalidChallenge
+	}
+
+	hash := sha256.Sum256([]byte(challenge + ":" + nonce))
+	if leadingZeroBits(hash[:]) < difficulty {
+		return errors.New("nonce does not solve the challenge")
+	}
+	_, ok, err := p.used.Reserve(ctx, []string{"pow:" + parts[0]}, remaining)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("challenge already used")
+	}
+	return nil
+}
+
+func (p *ProofOfWork) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	err := p.Verify(r.Context(), r.Header.Get("X-Pow-Challenge"), r.Header.Get("X-Pow-Nonce"))
+	if err != nil {
+		log.WithError(err).Debug("Proof of work rejected")
+		rejectClaim(r, metrics.ReasonPoWFailed)
+		renderClaim(w, claimResponse{Code: codePoWFailed, Message: "Proof of work verification failed, please try again"}, http.StatusForbidden)
+		return
+	}
+
+	next.ServeHTTP(w, r)
+}
+
+func (p *ProofOfWork) sign(payload string) string {
+	mac := hmac.New(sha256.New, p.key)
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func leadingZeroBits(b []byte) int {
+	n := 0
+	for _, x := range b {
+		if x != 0 {
+			return n + bits.LeadingZeros8(x)
+		}
+		n += 8
+	}
+	return n
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func solveChallenge(challenge string, difficulty int) string {
+	for nonce := 0; ; nonce++ {
+		hash := sha256.Sum256([]byte(challenge + ":" + strconv.Itoa(nonce)))
+		if leadingZeroBits(hash[:]) >= difficulty {
+			return strconv.Itoa(nonce)
+		}
+	}
+}
+
+func TestProofOfWork(t *testing.T) {
+	ctx := context.Background()
+	pow := NewProofOfWork([]byte("secret"), 8, time.Minute, NewMemoryStore())
+	challenge, err := pow.Challenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := solveChallenge(challenge, 8)
+
+	parts := strings.Split(challenge, ".")
+	easier := strings.Join([]string{parts[0], parts[1], "0", parts[3]}, ".")
+	if err := pow.Verify(ctx, easier, "0"); err != errInvalidChallenge {
+		t.Errorf("Verify() of a challenge with tampered difficulty = %v", err)
+	}
+	other := NewProofOfWork([]byte("other"), 8, time.Minute, NewMemoryStore())
+	if err := other.Verify(ctx, challenge, nonce); err != errInvalidChallenge {
+		t.Errorf("Verify() of a challenge signed with another key = %v", err)
+	}
+	for wrong := 0; ; wrong++ {
+		hash := sha256.Sum256([]byte(challenge + ":" + strconv.Itoa(wrong)))
+		if leadingZeroBits(hash[:]) < 8 {
+			if err := pow.Verify(ctx, challenge, strconv.Itoa(wrong)); err == nil {
+				t.Error("Verify() accepted a wrong nonce")
+			}
+			break
+		}
+	}
+	if err := pow.Verify(ctx, challenge, nonce); err != nil {
+		t.Errorf("Verify() of a solved challenge = %v", err)
+	}
+	if err := pow.Verify(ctx, challenge, nonce); err == nil {
+		t.Error("Verify() accepted a challenge twice")
+	}
+
+	expired := NewProofOfWork([]byte("secret"), 0, -time.Second, NewMemoryStore())
+	challenge, _ = expired.Challenge()
+	if err := expired.Verify(ctx, challenge, "0"); err == nil {
+		t.Error("Verify() accepted an expired challenge")
+	}
+}
@@ -2,122 +2,796 @@ package server
 
 import (
 	"context"
+	"crypto/rand"
 	"errors"
 	"fmt"
-	"math/big"
+	"math"
 	"net/http"
+	"path"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/shopspring/decimal"
 	log "github.com/sirupsen/logrus"
 	"github.com/urfave/negroni/v3"
 
 	"github.com/chainflag/eth-faucet/internal/chain"
+	"github.com/chainflag/eth-faucet/internal/metrics"
 	"github.com/chainflag/eth-faucet/web"
 )
 
+const (
+	claimQueueSize  = 1000
+	balanceInterval = 30 * time.Second
+)
+
 type Server struct {
-	txBuilder chain.TxBuilder
-	cfg       *Config
-	server    *http.Server
-	payoutWei *big.Int
+	networks       []*network
+	limitStore     LimitStore
+	allowlist      *AccessList
+	denylist       *AccessList
+	apiKeys        *APIKeys
+	history        *ClaimHistory
+	powKey         []byte
+	sessionKey     []byte
+	settings       atomic.Value
+	server         *http.Server
+	adminServer    *http.Server
+	stopBackground context.CancelFunc
+	background     sync.WaitGroup
+}
+
+// settings are the parts of the server that can be reloaded. They are
+// swapped as a whole, so a request sees either the old or the new settings.
+type settings struct {
+	cfg     *Config
+	captcha *Captcha
+	pow     *ProofOfWork
+	github  *GitHubAuth
+}
+
+func (s *Server) newSettings(cfg *Config) *settings {
+	st := &settings{cfg: cfg}
+	if provider := newCaptchaProvider(cfg.captcha); provider != nil {
+		st.captcha = NewCaptcha(provider, cfg.proxyCount)
+	}
+	if cfg.powDifficulty > 0 {
+		key := s.powKey
+		if cfg.powSecret != "" {
+			key = []byte(cfg.powSecret)
+		}
+		st.pow = NewProofOfWork(key, cfg.powDifficulty, cfg.powTTL, s.limitStore)
+	}
+	if cfg.github.ClientID != "" {
+		key := s.sessionKey
+		if cfg.authSecret != "" {
+			key = []byte(cfg.authSecret)
+		}
+		st.github = NewGitHubAuth(cfg.github.ClientID, cfg.github.ClientSecret, key)
+	}
+	return st
+}
+
+// NewServer serves every network in cfg, funding claims on each through the
+// builder registered under its name and checking recipients with the
+// eligibility checker of the same name, if any. The first network is the
+// default one. The claim history is optional and may be nil.
+func NewServer(builders map[string]chain.TxBuilder, checkers map[string]*chain.EligibilityChecker, store LimitStore, history *ClaimHistory, cfg *Config) *Server {
+	s := &Server{
+		limitStore: store,
+		history:    history,
+		allowlist:  NewAccessList(),
+		denylist:   NewAccessList(),
+		apiKeys:    NewAPIKeys(),
+		// Sign challenges and sessions unless secrets shared between
+		// instances are configured
+		powKey:     make([]byte, 32),
+		sessionKey: make([]byte, 32),
+	}
+	if _, err := rand.Read(s.powKey); err != nil {
+		panic(fmt.Errorf("failed to generate proof of work key: %w", err))
+	}
+	if _, err := rand.Read(s.sessionKey); err != nil {
+		panic(fmt.Errorf("failed to generate session key: %w", err))
+	}
+	for i := range cfg.networks {
+		networkCfg := &cfg.networks[i]
+		networkStore := store
+		if len(cfg.networks) > 1 {
+			// Networks share the store but keep separate rate limits
+			networkStore = newPrefixStore(store, strings.ToLower(networkCfg.network)+":")
+		}
+		n := newNetwork(builders[networkCfg.network], checkers[networkCfg.network], networkStore, cfg.proxyCount, s.allowlist, s.denylist, networkCfg)
+		if history != nil {
+			n.dispatcher.OnUpdate(history.Dispatched)
+		}
+		s.networks = append(s.networks, n)
+	}
+	s.settings.Store(s.newSettings(cfg))
+	return s
+}
+
+// LoadAccessLists reads the allowlist and denylist files of the current
+// settings. The lists apply to every network.
+func (s *Server) LoadAccessLists() error {
+	cfg := s.current().cfg
+	if err := s.allowlist.Load(cfg.allowlist); err != nil {
+		return fmt.Errorf("allowlist: %w", err)
+	}
+	if err := s.denylist.Load(cfg.denylist); err != nil {
+		return fmt.Errorf("denylist: %w", err)
+	}
+	return nil
+}
+
+// LoadAPIKeys reads the API key file of the current settings, along with
+// the keys listed in the deprecated auth.apikeys setting.
+func (s *Server) LoadAPIKeys() error {
+	cfg := s.current().cfg
+	return s.apiKeys.Load(cfg.keyFile, cfg.apiKeyHashes)
+}
+
+func (s *Server) current() *settings {
+	return s.settings.Load().(*settings)
 }
 
-func NewServer(builder chain.TxBuilder, cfg *Config) *Server {
-	return &Server{
-		txBuilder: builder,
-		cfg:       cfg,
-		payoutWei: chain.EtherToWei(cfg.payout),
+// Reload swaps in cfg as the server configuration. Requests and claims that
+// are already in flight finish under the settings they started with. The
+// listener port, proxy count, batch policy and set of networks only change
+// on restart. The access lists and API keys are only read again from a file
+// other than the one they were loaded from, so edits made through the admin
+// API survive a reload.
+func (s *Server) Reload(cfg *Config) {
+	s.settings.Store(s.newSettings(cfg))
+	if err := s.allowlist.Reload(cfg.allowlist); err != nil {
+		log.WithError(err).Error("Failed to reload allowlist, keeping the current entries")
+	}
+	if err := s.denylist.Reload(cfg.denylist); err != nil {
+		log.WithError(err).Error("Failed to reload denylist, keeping the current entries")
+	}
+	if err := s.apiKeys.Reload(cfg.keyFile, cfg.apiKeyHashes); err != nil {
+		log.WithError(err).Error("Failed to reload API keys, keeping the current keys")
+	}
+	for _, n := range s.networks {
+		networkCfg, ok := cfg.findNetwork(n.id)
+		if !ok {
+			log.WithField("network", n.id).Warn("Network missing from reloaded configuration, keeping its current settings")
+			continue
+		}
+		n.reload(networkCfg)
+		log.WithFields(log.Fields{
+			"network":  n.id,
+			"payout":   networkCfg.payout,
+			"interval": networkCfg.interval,
+		}).Info("Network configuration reloaded")
 	}
+	log.WithFields(log.Fields{
+		"captcha":       cfg.captcha.Provider,
+		"powDifficulty": cfg.powDifficulty,
+	}).Info("Configuration reloaded")
 }
 
 func (s *Server) setupRouter() *http.ServeMux {
 	router := http.NewServeMux()
 	router.Handle("/", http.FileServer(web.Dist()))
-	limiter := NewLimiter(s.cfg.proxyCount, time.Duration(s.cfg.interval)*time.Minute)
-	middlewares := []negroni.Handler{limiter}
-	if s.cfg.hcaptchaSecret != "" {
-		middlewares = append(middlewares, NewCaptcha(s.cfg.hcaptchaSiteKey, s.cfg.hcaptchaSecret))
+	// The default network is also served without a network in the path
+	s.routeNetwork(router, "/api/", s.networks[0])
+	if len(s.networks) > 1 {
+		for _, n := range s.networks {
+			s.routeNetwork(router, "/api/"+n.id+"/", n)
+		}
+	}
+	router.Handle("/api/challenge", s.handleChallenge())
+	router.Handle("/auth/github/login", s.handleGitHub((*GitHubAuth).handleLogin))
+	router.Handle("/auth/github/callback", s.handleGitHub((*GitHubAuth).handleCallback))
+	router.HandleFunc("/auth/logout", handleLogout)
+	router.Handle("/metrics", metrics.Handler(s.collectors()...))
+	if s.current().cfg.admin.Listen == "" {
+		router.Handle("/admin/", s.adminRouter())
 	}
-	middlewares = append(middlewares, negroni.Wrap(s.handleClaim()))
-	router.Handle("/api/claim", negroni.New(middlewares...))
-	router.Handle("/api/info", s.handleInfo())
 
 	return router
 }
 
+func (s *Server) routeNetwork(router *http.ServeMux, prefix string, n *network) {
+	router.Handle(prefix+"claim", negroni.New(s.recordClaim(n), negroni.HandlerFunc(s.identify), n.limiter, negroni.HandlerFunc(s.verifyCaptcha), negroni.HandlerFunc(s.verifyProofOfWork), negroni.Wrap(s.handleClaim(n))))
+	router.Handle(prefix+"claim/", s.handleClaimStatus(n))
+	router.Handle(prefix+"info", s.handleInfo(n))
+	router.Handle(prefix+"stats", s.handleStats(n))
+	router.Handle(prefix+"recent", s.handleRecent(n))
+}
+
 func (s *Server) Run() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.stopBackground = cancel
+	for _, n := range s.networks {
+		n.run(ctx, &s.background)
+	}
+
 	n := negroni.New(negroni.NewRecovery(), negroni.NewLogger())
 	n.UseHandler(s.setupRouter())
 
 	s.server = &http.Server{
-		Addr:         ":" + strconv.Itoa(s.cfg.httpPort),
+		Addr:         ":" + strconv.Itoa(s.current().cfg.httpPort),
 		Handler:      n,
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
 	}
 
-	log.Infof("Starting http server on port %d", s.cfg.httpPort)
+	if listen := s.current().cfg.admin.Listen; listen != "" {
+		admin := negroni.New(negroni.NewRecovery(), negroni.NewLogger())
+		admin.UseHandler(s.adminRouter())
+		s.adminServer = &http.Server{
+			Addr:         listen,
+			Handler:      admin,
+			ReadTimeout:  15 * time.Second,
+			WriteTimeout: 15 * time.Second,
+			IdleTimeout:  60 * time.Second,
+		}
+		go func() {
+			log.Infof("Starting admin server on %s", listen)
+			if err := s.adminServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatalf("Admin server failed to start: %v", err)
+			}
+		}()
+	}
+
+	log.Infof("Starting http server on port %d", s.current().cfg.httpPort)
 	if err := s.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatalf("Server failed to start: %v", err)
 	}
 }
 
 func (s *Server) Shutdown(ctx context.Context) error {
+	if s.stopBackground != nil {
+		s.stopBackground()
+		// Let the dispatchers refund the claims they drop before the
+		// stores are closed
+		s.background.Wait()
+	}
+	if s.adminServer != nil {
+		if err := s.adminServer.Shutdown(ctx); err != nil {
+			log.WithError(err).Error("Admin server forced to shutdown")
+		}
+	}
 	if s.server != nil {
 		return s.server.Shutdown(ctx)
 	}
 	return nil
 }
 
-func (s *Server) handleClaim() http.HandlerFunc {
+// verifyCaptcha checks the captcha with the current settings, if enabled.
+// Claims made with an API key need not solve one.
+func (s *Server) verifyCaptcha(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	if captcha := s.current().captcha; captcha != nil && !hasAPIKey(r) {
+		captcha.ServeHTTP(w, r, next)
+		return
+	}
+	next(w, r)
+}
+
+// verifyProofOfWork checks the solved challenge with the current settings,
+// if enabled. Claims made with an API key need not solve one.
+func (s *Server) verifyProofOfWork(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	if pow := s.current().pow; pow != nil && !hasAPIKey(r) {
+		pow.ServeHTTP(w, r, next)
+		return
+	}
+	next(w, r)
+}
+
+// handleGitHub serves a sign in endpoint while GitHub sign in is enabled.
+func (s *Server) handleGitHub(handle func(*GitHubAuth, http.ResponseWriter, *http.Request)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		github := s.current().github
+		if github == nil || r.Method != http.MethodGet {
+			http.NotFound(w, r)
+			return
+		}
+		handle(github, w, r)
+	}
+}
+
+func (s *Server) handleChallenge() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.NotFound(w, r)
+			return
+		}
+		pow := s.current().pow
+		if pow == nil {
+			renderJSON(w, claimResponse{Message: "Proof of work is not enabled"}, http.StatusNotFound)
+			return
+		}
+
+		challenge, err := pow.Challenge()
+		if err != nil {
+			log.WithError(err).Error("Failed to issue proof of work challenge")
+			renderJSON(w, claimResponse{Message: http.StatusText(http.StatusInternalServerError)}, http.StatusInternalServerError)
+			return
+		}
+		renderJSON(w, challengeResponse{Challenge: challenge, Difficulty: pow.difficulty}, http.StatusOK)
+	}
+}
+
+func (s *Server) handleClaim(n *network) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
+		st := n.current()
 
 		address, ok := r.Context().Value(addressContextKey).(string)
 		if !ok || address == "" {
-			renderJSON(w, claimResponse{Message: "invalid request"}, http.StatusBadRequest)
+			rejectClaim(r, metrics.ReasonMalformed)
+			renderClaim(w, claimResponse{Code: codeInvalidRequest, Message: "invalid request"}, http.StatusBadRequest)
 			return
 		}
 
-		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
-		defer cancel()
+		if n.isPaused() {
+			rejectClaim(r, metrics.ReasonPaused)
+			renderClaim(w, claimResponse{Code: codePaused, Message: "The faucet is paused, please try again later"}, http.StatusServiceUnavailable)
+			return
+		}
+
+		// Token transfers need gas too, so no claims are accepted while funds are low
+		if balance, ok := n.balances.Balance(); ok && st.cfg.funds.Low(balance) {
+			log.WithFields(log.Fields{
+				"balance": chain.FromBaseUnits(balance, 18),
+				"network": n.id,
+				"address": address,
+			}).Warn("Refusing claim while faucet balance is low")
+			rejectClaim(r, metrics.ReasonLowFunds)
+			renderClaim(w, claimResponse{Code: codeInsufficientFunds, Message: "The faucet is running low on funds, please try again later"}, http.StatusServiceUnavailable)
+			return
+		}
+
+		tier, _ := r.Context().Value(tierContextKey).(*Tier)
+		req := chain.ClaimRequest{To: address, Value: n.currentPayout(st, tier)}
+		symbol, _ := r.Context().Value(tokenContextKey).(string)
+		if symbol != "" {
+			token, ok := st.cfg.findToken(symbol)
+			if !ok {
+				rejectClaim(r, metrics.ReasonUnsupportedToken)
+				renderClaim(w, claimResponse{Code: codeUnsupportedToken, Message: fmt.Sprintf("Unsupported token %s", symbol)}, http.StatusBadRequest)
+				return
+			}
+			req.Token = &token.Address
+			req.Value = chain.ToBaseUnits(token.Payout, token.Decimals)
+		}
+
+		ident, _ := r.Context().Value(identityContextKey).(identity)
+		key := ident.APIKey
+		if key != nil && key.MaxAmount > 0 && req.Token == nil {
+			if limit := chain.EtherToWei(key.MaxAmount); req.Value.Cmp(limit) > 0 {
+				req.Value = limit
+			}
+		}
+
+		if n.checker != nil && st.cfg.eligibility.Enabled() {
+			ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+			err := n.checker.Check(ctx, common.HexToAddress(address), st.cfg.eligibility)
+			cancel()
+			var ineligible *chain.IneligibleError
+			if errors.As(err, &ineligible) {
+				log.WithFields(log.Fields{
+					"network":     n.id,
+					"address":     address,
+					"requirement": ineligible.Requirement,
+				}).Info("Refusing claim from ineligible recipient")
+				rejectClaim(r, metrics.ReasonIneligible)
+				renderClaim(w, claimResponse{Code: codeIneligible, Message: s.ineligibleMessage(st.cfg, ineligible)}, http.StatusForbidden)
+				return
+			} else if err != nil {
+				log.WithFields(log.Fields{
+					"error":   err,
+					"network": n.id,
+					"address": address,
+				}).Error("Failed to check recipient eligibility")
+				rejectClaim(r, metrics.ReasonEligibilityError)
+				renderClaim(w, claimResponse{Code: codeRPCError, Message: "Unable to check your eligibility, please try again later"}, http.StatusServiceUnavailable)
+				return
+			}
+		}
+
+		// Token payouts are not counted against the budgets, which are in Ethers
+		now := time.Now()
+		budget := st.cfg.budget
+		if budget.Enabled() && req.Token == nil {
+			exhausted, err := budget.Spend(r.Context(), n.store, req.Value, now)
+			if err != nil {
+				log.WithError(err).Error("Failed to apply distribution budget")
+				renderClaim(w, claimResponse{Code: codeInternalError, Message: http.StatusText(http.StatusInternalServerError)}, http.StatusInternalServerError)
+				return
+			}
+			if exhausted != nil {
+				log.WithFields(log.Fields{
+					"network": n.id,
+					"address": address,
+					"period":  exhausted.name,
+				}).Warn("Refusing claim over the distribution budget")
+				rejectClaim(r, metrics.ReasonBudgetExhausted)
+				wait := exhausted.resetsAt.Sub(now)
+				errMsg := fmt.Sprintf("The faucet's %s budget is exhausted, it resets in %s", exhausted.name, wait.Round(time.Second))
+				renderClaim(w, claimResponse{Code: codeBudgetExhausted, Message: errMsg, RetryAfter: retryAfter(wait)}, http.StatusTooManyRequests)
+				return
+			}
+		}
+		refundDistribution := func() {
+			if budget.Enabled() && req.Token == nil {
+				if err := budget.Refund(context.Background(), n.store, req.Value, now); err != nil {
+					log.WithError(err).Error("Failed to refund distribution budget")
+				}
+			}
+		}
+		if key != nil && key.DailyBudget > 0 && req.Token == nil {
+			ok, err := spendBudget(r.Context(), n.store, key, req.Value, now)
+			if err != nil {
+				log.WithError(err).Error("Failed to apply API key budget")
+				refundDistribution()
+				renderClaim(w, claimResponse{Code: codeInternalError, Message: http.StatusText(http.StatusInternalServerError)}, http.StatusInternalServerError)
+				return
+			}
+			if !ok {
+				refundDistribution()
+				rejectClaim(r, metrics.ReasonBudgetExhausted)
+				errMsg := fmt.Sprintf("The API key has used up its daily budget of %s %s, it resets at midnight UTC", strconv.FormatFloat(key.DailyBudget, 'f', -1, 64), st.cfg.symbol)
+				midnight := now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+				renderClaim(w, claimResponse{Code: codeBudgetExhausted, Message: errMsg, RetryAfter: retryAfter(midnight.Sub(now))}, http.StatusTooManyRequests)
+				return
+			}
+		}
 
-		txHash, err := s.txBuilder.Transfer(ctx, address, new(big.Int).Set(s.payoutWei))
+		refund, ok := r.Context().Value(refundContextKey).(*claimRefund)
+		if !ok {
+			refund = &claimRefund{}
+		}
+		refund.add(refundDistribution)
+		refundKey := func() {
+			if err := refundUsage(context.Background(), n.store, key, req, now); err != nil {
+				log.WithError(err).Error("Failed to refund API key usage")
+			}
+		}
+		if key != nil {
+			if err := recordUsage(r.Context(), n.store, key, req); err != nil {
+				log.WithError(err).Warn("Failed to record API key usage")
+			}
+			refund.add(refundKey)
+		}
+		id, position, err := n.enqueue(req, refund.run)
 		if err != nil {
 			log.WithFields(log.Fields{
 				"error":   err,
+				"network": n.id,
 				"address": address,
-			}).Error("Failed to send transaction")
-			renderJSON(w, claimResponse{Message: fmt.Sprintf("Transaction failed: %v", err)}, http.StatusInternalServerError)
+				"token":   symbol,
+			}).Error("Failed to enqueue claim")
+			refundDistribution()
+			if key != nil {
+				refundKey()
+			}
+			rejectClaim(r, metrics.ReasonQueueFull)
+			renderClaim(w, claimResponse{Code: codeQueueFull, Message: "The faucet is busy, please try again later"}, http.StatusServiceUnavailable)
 			return
 		}
 
-		log.WithFields(log.Fields{
-			"txHash":  txHash,
-			"address": address,
-		}).Info("Transaction sent successfully")
-		resp := claimResponse{Message: fmt.Sprintf("Txhash: %s", txHash)}
-		renderJSON(w, resp, http.StatusOK)
+		fields := log.Fields{
+			"claimID":  id,
+			"position": position,
+			"network":  n.id,
+			"address":  address,
+			"token":    symbol,
+			"tier":     tierName(tier),
+		}
+		if key != nil {
+			fields["apiKey"] = key.Name
+		}
+		log.WithFields(fields).Info("Claim queued")
+		metrics.ClaimsAccepted.Inc()
+		if rec := claimRecord(r); rec != nil {
+			rec.ClaimID = id
+			rec.Tier = tierName(tier)
+			rec.Amount = chain.FromBaseUnits(req.Value, 18)
+			if symbol != "" {
+				token, _ := st.cfg.findToken(symbol)
+				rec.Amount = chain.FromBaseUnits(req.Value, token.Decimals)
+			}
+			if key != nil {
+				rec.APIKey = key.Name
+			}
+		}
+		resp := claimResponse{
+			Code:     codeQueued,
+			Message:  fmt.Sprintf("Claim queued at position %d", position),
+			ClaimID:  id,
+			Position: position,
+			TxHash:   claimTxHash(n, id),
+			Tier:     tierName(tier),
+		}
+		renderClaim(w, resp, http.StatusOK)
+	}
+}
+
+// ineligibleMessage explains to the user which requirement they failed.
+func (s *Server) ineligibleMessage(cfg *NetworkConfig, err *chain.IneligibleError) string {
+	switch err.Requirement {
+	case chain.RequireMaxBalance:
+		return fmt.Sprintf("Your balance of %s %s exceeds the limit of %s %s for claiming", chain.FromBaseUnits(err.Have, 18), cfg.symbol, chain.FromBaseUnits(err.Want, 18), cfg.symbol)
+	case chain.RequireMinNonce:
+		return fmt.Sprintf("Your address needs at least %s transactions on %s to claim, but has sent %s", err.Want, cfg.network, err.Have)
+	case chain.RequireMinActivity:
+		return fmt.Sprintf("Your address needs at least %s transactions on %s to claim, but has sent %s", err.Want, s.current().cfg.activityName, err.Have)
+	default:
+		return "Your address is not eligible to claim"
+	}
+}
+
+func (s *Server) handleClaimStatus(n *network) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.NotFound(w, r)
+			return
+		}
+
+		if path.Base(r.URL.Path) == "events" {
+			s.streamClaim(n, w, r, path.Base(path.Dir(r.URL.Path)))
+			return
+		}
+		id := path.Base(r.URL.Path)
+		status, ok := claimStatusOf(n, id)
+		if !ok {
+			renderClaim(w, claimResponse{Code: codeClaimNotFound, Message: claimNotFound(id)}, http.StatusNotFound)
+			return
+		}
+		renderJSON(w, status, http.StatusOK)
+	}
+}
+
+// claimStatusOf looks a claim up by the ID returned from /api/claim, or by
+// transaction hash.
+func claimStatusOf(n *network, id string) (claimStatusResponse, bool) {
+	if isValidTxHash(id) {
+		status, ok := n.txBuilder.Status(common.HexToHash(id))
+		if !ok {
+			return claimStatusResponse{}, false
+		}
+		return newClaimStatusResponse(&chain.ClaimStatus{State: chain.ClaimSent, TxHash: status.Hash, Tx: status}), true
+	}
+
+	status, ok := n.dispatcher.Status(id)
+	if !ok {
+		return claimStatusResponse{}, false
+	}
+	return newClaimStatusResponse(status), true
+}
+
+// claimTxHash returns the hash of the transaction of a claim, or an empty
+// string if it has not been sent yet.
+func claimTxHash(n *network, id string) string {
+	if status, ok := n.dispatcher.Status(id); ok && status.State == chain.ClaimSent {
+		return status.TxHash.Hex()
+	}
+	return ""
+}
+
+func claimNotFound(id string) string {
+	if isValidTxHash(id) {
+		return "Transaction not found"
 	}
+	return "Claim not found"
 }
 
-func (s *Server) handleInfo() http.HandlerFunc {
+func (s *Server) handleInfo(n *network) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			http.NotFound(w, r)
 			return
 		}
+		st := n.current()
+
+		// hcaptcha_sitekey is kept for frontends predating other providers
+		captcha := s.current().cfg.captcha
+		var hcaptchaSiteKey string
+		if captcha.Provider == "hcaptcha" {
+			hcaptchaSiteKey = captcha.SiteKey
+		}
+
+		var user string
+		if github := s.current().github; github != nil {
+			user, _ = github.User(r)
+		}
+		tiers := make([]tierInfo, len(st.cfg.tiers))
+		for i, tier := range st.cfg.tiers {
+			tiers[i] = tierInfo{
+				Name:     tier.Name,
+				Identity: tier.Identity,
+				Payout:   chain.FromBaseUnits(n.currentPayout(st, &st.cfg.tiers[i]), 18),
+				Minutes:  tier.Interval,
+			}
+		}
+
+		budget, err := st.cfg.budget.Remaining(r.Context(), n.store, time.Now())
+		if err != nil {
+			log.WithError(err).Warn("Failed to read distribution budget")
+		}
+
+		var balance string
+		var lowFunds bool
+		if wei, ok := n.balances.Balance(); ok {
+			balance = chain.FromBaseUnits(wei, 18)
+			lowFunds = st.cfg.funds.Low(wei)
+		}
 		renderJSON(w, infoResponse{
-			Account:         s.txBuilder.Sender().String(),
-			Network:         s.cfg.network,
-			Symbol:          s.cfg.symbol,
-			Payout:          strconv.FormatFloat(s.cfg.payout, 'f', -1, 64),
-			HcaptchaSiteKey: s.cfg.hcaptchaSiteKey,
+			Account:         n.txBuilder.Sender().String(),
+			Network:         st.cfg.network,
+			Symbol:          st.cfg.symbol,
+			Payout:          chain.FromBaseUnits(n.currentPayout(st, nil), 18),
+			HcaptchaSiteKey: hcaptchaSiteKey,
+			CaptchaProvider: captcha.Provider,
+			CaptchaSiteKey:  captcha.SiteKey,
+			Tokens:          n.tokenInfos(r.Context(), st.cfg.tokens),
+			QueueDepth:      n.dispatcher.Depth(),
+			Balance:         balance,
+			LowFunds:        lowFunds,
+			Networks:        s.networkInfos(),
+			Paused:          n.isPaused(),
+			PoWDifficulty:   s.current().cfg.powDifficulty,
+			Tiers:           tiers,
+			GitHubLogin:     s.current().github != nil,
+			User:            user,
+			Budget:          budget,
+		}, http.StatusOK)
+	}
+}
+
+const (
+	defaultRecentPayouts = 10
+	maxRecentPayouts     = 50
+)
+
+// handleStats reports statistics of the claims in the claim history.
+func (s *Server) handleStats(n *network) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || s.history == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		stats, err := s.history.Stats(n.id)
+		if err != nil {
+			log.WithError(err).Error("Failed to compute claim statistics")
+			renderJSON(w, claimResponse{Message: http.StatusText(http.StatusInternalServerError)}, http.StatusInternalServerError)
+			return
+		}
+		renderJSON(w, statsResponse{
+			Since:           stats.Since,
+			Distributed:     chain.FromBaseUnits(stats.Distributed, 18),
+			Symbol:          n.current().cfg.symbol,
+			ClaimsToday:     stats.ClaimsToday,
+			UniqueAddresses: stats.UniqueAddresses,
+			AverageLatency:  math.Round(stats.AverageLatency.Seconds()*10) / 10,
 		}, http.StatusOK)
 	}
 }
+
+// handleRecent lists the latest payouts in the claim history, up to the
+// number given by the limit query parameter.
+func (s *Server) handleRecent(n *network) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || s.history == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		limit := defaultRecentPayouts
+		if value := r.URL.Query().Get("limit"); value != "" {
+			var err error
+			if limit, err = strconv.Atoi(value); err != nil || limit <= 0 {
+				renderJSON(w, claimResponse{Message: "limit must be a positive number"}, http.StatusBadRequest)
+				return
+			}
+			if limit > maxRecentPayouts {
+				limit = maxRecentPayouts
+			}
+		}
+		records, err := s.history.Query(HistoryQuery{Network: n.id, Outcome: OutcomeSent, Limit: limit})
+		if err != nil {
+			log.WithError(err).Error("Failed to query claim history")
+			renderJSON(w, claimResponse{Message: http.StatusText(http.StatusInternalServerError)}, http.StatusInternalServerError)
+			return
+		}
+
+		payouts := make([]recentPayout, len(records))
+		for i, rec := range records {
+			symbol := strings.ToUpper(rec.Token)
+			if symbol == "" {
+				symbol = n.current().cfg.symbol
+			}
+			payouts[i] = recentPayout{
+				Address: truncateAddress(rec.Address),
+				Amount:  rec.Amount,
+				Symbol:  symbol,
+				TxHash:  rec.TxHash,
+				Time:    rec.SentAt,
+			}
+		}
+		renderJSON(w, payouts, http.StatusOK)
+	}
+}
+
+// truncateAddress keeps the start and end of an address, enough to recognize
+// one's own.
+func truncateAddress(address string) string {
+	if len(address) < 12 {
+		return address
+	}
+	return address[:6] + "…" + address[len(address)-4:]
+}
+
+// networkInfos lists the networks to choose from, if there is more than one.
+func (s *Server) networkInfos() []networkInfo {
+	if len(s.networks) < 2 {
+		return nil
+	}
+	infos := make([]networkInfo, len(s.networks))
+	for i, n := range s.networks {
+		cfg := n.current().cfg
+		infos[i] = networkInfo{ID: n.id, Name: cfg.network, Symbol: cfg.symbol}
+	}
+	return infos
+}
+
+// collectors reports the state owned by this server alongside the shared metrics.
+func (s *Server) collectors() []prometheus.Collector {
+	collectors := []prometheus.Collector{
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: "faucet",
+			Name:      "limiter_records",
+			Help:      "Number of cooldown records held by the limiter store.",
+		}, func() float64 {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			n, err := s.limitStore.Len(ctx)
+			if err != nil {
+				log.WithError(err).Warn("Failed to count cooldown records")
+				return math.NaN()
+			}
+			return float64(n)
+		}),
+	}
+	for _, n := range s.networks {
+		n := n
+		labels := prometheus.Labels{"network": n.id}
+		collectors = append(collectors,
+			prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Namespace:   "faucet",
+				Name:        "queue_depth",
+				Help:        "Number of claims waiting to be dispatched.",
+				ConstLabels: labels,
+			}, func() float64 {
+				return float64(n.dispatcher.Depth())
+			}),
+			prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Namespace:   "faucet",
+				Name:        "balance_ether",
+				Help:        "Native currency balance of the faucet in Ethers.",
+				ConstLabels: labels,
+			}, func() float64 {
+				balance, ok := n.balances.Balance()
+				if !ok {
+					return math.NaN()
+				}
+				ether, _ := decimal.NewFromBigInt(balance, -18).Float64()
+				return ether
+			}),
+		)
+	}
+	return collectors
+}
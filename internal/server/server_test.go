@@ -3,15 +3,23 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"math/big"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/stretchr/testify/mock"
+	"github.com/urfave/negroni/v3"
 
 	"github.com/chainflag/eth-faucet/internal/chain"
+	"github.com/chainflag/eth-faucet/internal/config"
+	"github.com/chainflag/eth-faucet/internal/metrics"
 )
 
 type MockTxBuilder struct {
@@ -28,16 +36,70 @@ func (m *MockTxBuilder) Transfer(ctx context.Context, to string, value *big.Int)
 	return args.Get(0).(common.Hash), args.Error(1)
 }
 
+func (m *MockTxBuilder) TransferToken(ctx context.Context, token common.Address, to string, value *big.Int) (common.Hash, error) {
+	args := m.Called(ctx, token, to, value)
+	return args.Get(0).(common.Hash), args.Error(1)
+}
+
+func (m *MockTxBuilder) Balance(ctx context.Context) (*big.Int, error) {
+	args := m.Called(ctx)
+	balance, _ := args.Get(0).(*big.Int)
+	return balance, args.Error(1)
+}
+
+func (m *MockTxBuilder) TokenBalance(ctx context.Context, token common.Address) (*big.Int, error) {
+	args := m.Called(ctx, token)
+	return args.Get(0).(*big.Int), args.Error(1)
+}
+
+func (m *MockTxBuilder) Disperse(ctx context.Context, contract common.Address, recipients []common.Address, values []*big.Int) (common.Hash, error) {
+	args := m.Called(ctx, contract, recipients, values)
+	return args.Get(0).(common.Hash), args.Error(1)
+}
+
+func (m *MockTxBuilder) Status(hash common.Hash) (*chain.TxStatus, bool) {
+	args := m.Called(hash)
+	status, _ := args.Get(0).(*chain.TxStatus)
+	return status, args.Bool(1)
+}
+
+func (m *MockTxBuilder) RefreshNonce(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+
 func setupTestServer(mockBuilder chain.TxBuilder) *Server {
 	cfg := &Config{
 		httpPort:   8080,
 		proxyCount: 0,
-		interval:   0,
-		network:    "testnet",
-		symbol:     "ETH",
-		payout:     1.0,
+		networks: []NetworkConfig{{
+			interval: 0,
+			network:  "testnet",
+			symbol:   "ETH",
+			payout:   1.0,
+			tokens: []TokenConfig{
+				{Symbol: "USDC", Address: common.HexToAddress("0x1c7D4B196Cb0C7B01d743Fbc6116a902379C7238"), Decimals: 6, Payout: 10},
+			},
+		}},
+	}
+	return NewServer(map[string]chain.TxBuilder{"testnet": mockBuilder}, nil, NewMemoryStore(), nil, cfg)
+}
+
+func waitForClaim(t *testing.T, server *Server, id string) *chain.ClaimStatus {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go server.networks[0].dispatcher.Run(ctx)
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		status, ok := server.networks[0].dispatcher.Status(id)
+		if ok && status.State != chain.ClaimQueued && status.State != chain.ClaimSending {
+			return status
+		}
+		time.Sleep(10 * time.Millisecond)
 	}
-	return NewServer(mockBuilder, cfg)
+	t.Fatalf("claim %s was not dispatched", id)
+	return nil
 }
 
 func TestHandleClaim(t *testing.T) {
@@ -45,6 +107,7 @@ func TestHandleClaim(t *testing.T) {
 	expectedAddress := "0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045"
 	expectedAmount := chain.EtherToWei(1.0)
 	mockBuilder.On("Transfer", mock.Anything, expectedAddress, expectedAmount).Return(common.Hash{1}, nil)
+	mockBuilder.On("Status", common.Hash{1}).Return(nil, false)
 
 	server := setupTestServer(mockBuilder)
 	req, err := http.NewRequest("POST", "/api/claim", nil)
@@ -54,7 +117,7 @@ func TestHandleClaim(t *testing.T) {
 	req = req.WithContext(context.WithValue(req.Context(), addressContextKey, expectedAddress))
 
 	rr := httptest.NewRecorder()
-	handler := server.handleClaim()
+	handler := server.handleClaim(server.networks[0])
 	handler.ServeHTTP(rr, req)
 
 	if rr.Code != http.StatusOK {
@@ -66,14 +129,414 @@ func TestHandleClaim(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
+	if resp.ClaimID == "" || resp.Position != 1 || resp.TxHash != "" {
+		t.Fatalf("Expected queued claim, got %+v", resp)
+	}
 
+	status := waitForClaim(t, server, resp.ClaimID)
+	if status.State != chain.ClaimSent || status.TxHash != (common.Hash{1}) {
+		t.Errorf("Unexpected claim status %+v", status)
+	}
+	// The hash is reported once known
+	if hash := claimTxHash(server.networks[0], resp.ClaimID); hash != (common.Hash{1}).Hex() {
+		t.Errorf("Expected the hash of the sent claim, got %q", hash)
+	}
 	mockBuilder.AssertExpectations(t)
+}
 
+func TestHandleClaimFailed(t *testing.T) {
+	mockBuilder := new(MockTxBuilder)
+	mockBuilder.On("Transfer", mock.Anything, mock.Anything, mock.Anything).Return(common.Hash{}, errors.New("connection refused")).Once()
+	mockBuilder.On("Transfer", mock.Anything, mock.Anything, mock.Anything).Return(common.Hash{1}, nil)
+	mockBuilder.On("Status", common.Hash{1}).Return(nil, false)
+	cfg := &Config{networks: []NetworkConfig{{network: "testnet", symbol: "ETH", payout: 1, interval: 60}}}
+	server := NewServer(map[string]chain.TxBuilder{"testnet": mockBuilder}, nil, NewMemoryStore(), nil, cfg)
+	router := server.setupRouter()
+
+	claim := func() claimResponse {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("POST", "/api/claim", strings.NewReader(`{"address": "0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045"}`)))
+		var resp claimResponse
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, but got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+		return resp
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n := server.networks[0]
+	go n.dispatcher.Run(ctx)
+	// Waits until the claim is dispatched and settled
+	wait := func(id string) *chain.ClaimStatus {
+		for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			n.refundMu.Lock()
+			_, pending := n.refunds[id]
+			n.refundMu.Unlock()
+			if status, _ := n.dispatcher.Status(id); !pending && (status.State == chain.ClaimSent || status.State == chain.ClaimFailed) {
+				return status
+			}
+		}
+		t.Fatalf("claim %s was not dispatched", id)
+		return nil
+	}
+
+	failed := wait(claim().ClaimID)
+	if failed.State != chain.ClaimFailed {
+		t.Fatalf("Expected the claim to fail, got %+v", failed)
+	}
+	rr := httptest.NewRecorder()
+	server.handleClaimStatus(n).ServeHTTP(rr, httptest.NewRequest("GET", "/api/claim/"+failed.ID+"/events", nil))
+	if body := rr.Body.String(); !strings.Contains(body, "event: failed") || !strings.Contains(body, `"code":"tx_failed"`) {
+		t.Errorf("Expected a failed event with the tx_failed code, got %s", body)
+	}
+	// The failed claim does not hold back the address and IP
+	if status := wait(claim().ClaimID); status.State != chain.ClaimSent {
+		t.Errorf("Expected the retried claim to be sent, got %+v", status)
+	}
+}
+
+func TestHandleClaimToken(t *testing.T) {
+	mockBuilder := new(MockTxBuilder)
+	expectedAddress := "0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045"
+	tokenAddress := common.HexToAddress("0x1c7D4B196Cb0C7B01d743Fbc6116a902379C7238")
+	mockBuilder.On("TransferToken", mock.Anything, tokenAddress, expectedAddress, big.NewInt(10000000)).Return(common.Hash{1}, nil)
+	mockBuilder.On("Status", common.Hash{1}).Return(nil, false)
+
+	server := setupTestServer(mockBuilder)
+	var claimID string
+	for symbol, wantCode := range map[string]int{"USDC": http.StatusOK, "DAI": http.StatusBadRequest} {
+		req, err := http.NewRequest("POST", "/api/claim", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx := context.WithValue(req.Context(), addressContextKey, expectedAddress)
+		req = req.WithContext(context.WithValue(ctx, tokenContextKey, symbol))
+
+		rr := httptest.NewRecorder()
+		handler := server.handleClaim(server.networks[0])
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != wantCode {
+			t.Errorf("Expected status %d for %s, but got %d", wantCode, symbol, rr.Code)
+		}
+		if rr.Code == http.StatusOK {
+			var resp claimResponse
+			json.Unmarshal(rr.Body.Bytes(), &resp)
+			claimID = resp.ClaimID
+		}
+	}
+
+	waitForClaim(t, server, claimID)
+	mockBuilder.AssertExpectations(t)
+}
+
+func TestHandleClaimLowFunds(t *testing.T) {
+	tests := []struct {
+		name       string
+		balance    *big.Int
+		wantCode   int
+		wantAmount *big.Int
+	}{
+		{name: "plenty", balance: chain.EtherToWei(100), wantCode: http.StatusOK, wantAmount: chain.EtherToWei(1)},
+		{name: "reduced", balance: chain.EtherToWei(5), wantCode: http.StatusOK, wantAmount: chain.EtherToWei(0.5)},
+		{name: "below minimum", balance: chain.EtherToWei(0.5), wantCode: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockBuilder := new(MockTxBuilder)
+			mockBuilder.On("Balance", mock.Anything).Return(tt.balance, nil)
+			if tt.wantAmount != nil {
+				mockBuilder.On("Transfer", mock.Anything, "0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045", tt.wantAmount).Return(common.Hash{1}, nil)
+				mockBuilder.On("Status", common.Hash{1}).Return(nil, false)
+			}
+
+			server := setupTestServer(mockBuilder)
+			server.networks[0].current().cfg.funds = chain.FundsPolicy{MinBalance: chain.EtherToWei(1), ReduceBelow: chain.EtherToWei(10)}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go server.networks[0].balances.Run(ctx)
+			for _, ok := server.networks[0].balances.Balance(); !ok; _, ok = server.networks[0].balances.Balance() {
+				time.Sleep(time.Millisecond)
+			}
+
+			req, err := http.NewRequest("POST", "/api/claim", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req = req.WithContext(context.WithValue(req.Context(), addressContextKey, "0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045"))
+
+			rr := httptest.NewRecorder()
+			server.handleClaim(server.networks[0]).ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantCode {
+				t.Fatalf("Expected status %d, but got %d", tt.wantCode, rr.Code)
+			}
+			if rr.Code == http.StatusOK {
+				var resp claimResponse
+				json.Unmarshal(rr.Body.Bytes(), &resp)
+				waitForClaim(t, server, resp.ClaimID)
+			}
+			mockBuilder.AssertExpectations(t)
+		})
+	}
+}
+
+// stubAccounts serves fixed account state in place of a node.
+type stubAccounts struct {
+	balance *big.Int
+	nonce   uint64
+	err     error
+}
+
+func (s stubAccounts) BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error) {
+	return s.balance, s.err
+}
+
+func (s stubAccounts) NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error) {
+	return s.nonce, nil
+}
+
+func TestHandleClaimIneligible(t *testing.T) {
+	tests := []struct {
+		name       string
+		accounts   stubAccounts
+		policy     chain.EligibilityPolicy
+		wantCode   int
+		wantMsg    string
+		wantReason string
+	}{
+		{name: "eligible", accounts: stubAccounts{balance: chain.EtherToWei(0.5), nonce: 3}, policy: chain.EligibilityPolicy{MaxBalance: chain.EtherToWei(1), MinNonce: 1}, wantCode: http.StatusOK},
+		{name: "balance too high", accounts: stubAccounts{balance: chain.EtherToWei(2.5)}, policy: chain.EligibilityPolicy{MaxBalance: chain.EtherToWei(1)}, wantCode: http.StatusForbidden, wantMsg: "Your balance of 2.5 ETH exceeds the limit of 1 ETH for claiming", wantReason: metrics.ReasonIneligible},
+		{name: "fresh address", accounts: stubAccounts{balance: big.NewInt(0)}, policy: chain.EligibilityPolicy{MinNonce: 2}, wantCode: http.StatusForbidden, wantMsg: "Your address needs at least 2 transactions on testnet to claim, but has sent 0", wantReason: metrics.ReasonIneligible},
+		{name: "inactive on mainnet", accounts: stubAccounts{balance: big.NewInt(0)}, policy: chain.EligibilityPolicy{MinActivity: 1}, wantCode: http.StatusForbidden, wantMsg: "Your address needs at least 1 transactions on mainnet to claim, but has sent 0", wantReason: metrics.ReasonIneligible},
+		{name: "node unavailable", accounts: stubAccounts{err: errors.New("connection refused")}, policy: chain.EligibilityPolicy{MaxBalance: chain.EtherToWei(1)}, wantCode: http.StatusServiceUnavailable, wantMsg: "Unable to check your eligibility, please try again later", wantReason: metrics.ReasonEligibilityError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockBuilder := new(MockTxBuilder)
+			if tt.wantCode == http.StatusOK {
+				mockBuilder.On("Transfer", mock.Anything, "0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045", chain.EtherToWei(1)).Return(common.Hash{1}, nil)
+				mockBuilder.On("Status", common.Hash{1}).Return(nil, false)
+			}
+
+			server := setupTestServer(mockBuilder)
+			server.current().cfg.activityName = "mainnet"
+			n := server.networks[0]
+			n.checker = chain.NewEligibilityChecker(tt.accounts, tt.accounts)
+			n.current().cfg.eligibility = tt.policy
+
+			req := httptest.NewRequest("POST", "/api/claim", nil)
+			rec := &ClaimRecord{}
+			ctx := context.WithValue(req.Context(), addressContextKey, "0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045")
+			req = req.WithContext(context.WithValue(ctx, recordContextKey, rec))
+			rr := httptest.NewRecorder()
+			server.handleClaim(n).ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantCode {
+				t.Fatalf("Expected status %d, but got %d", tt.wantCode, rr.Code)
+			}
+			if rec.Reason != tt.wantReason {
+				t.Errorf("Expected rejection reason %q, but got %q", tt.wantReason, rec.Reason)
+			}
+			var resp claimResponse
+			json.Unmarshal(rr.Body.Bytes(), &resp)
+			if rr.Code == http.StatusOK {
+				waitForClaim(t, server, resp.ClaimID)
+			} else if resp.Message != tt.wantMsg {
+				t.Errorf("Expected message %q, but got %q", tt.wantMsg, resp.Message)
+			}
+			mockBuilder.AssertExpectations(t)
+		})
+	}
+}
+
+func TestHandleClaimBudget(t *testing.T) {
+	mockBuilder := new(MockTxBuilder)
+	mockBuilder.On("Sender").Return(common.Address{})
+	mockBuilder.On("TokenBalance", mock.Anything, mock.Anything).Return(big.NewInt(0), nil)
+	server := setupTestServer(mockBuilder)
+	n := server.networks[0]
+	cfg := *n.current().cfg
+	cfg.budget = Budget{Hourly: chain.EtherToWei(3), Daily: chain.EtherToWei(2)}
+	n.reload(&cfg)
+
+	var claimID string
+	claim := func(address string) (int, string) {
+		req := httptest.NewRequest("POST", "/api/claim", nil)
+		req = req.WithContext(context.WithValue(req.Context(), addressContextKey, address))
+		rr := httptest.NewRecorder()
+		server.handleClaim(n).ServeHTTP(rr, req)
+		var resp claimResponse
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		if resp.ClaimID != "" {
+			claimID = resp.ClaimID
+		}
+		return rr.Code, resp.Message
+	}
+	for i := 1; i <= 2; i++ {
+		if code, msg := claim(fmt.Sprintf("0x%040x", i)); code != http.StatusOK {
+			t.Fatalf("Expected claim %d within the budget to be queued, got %d: %s", i, code, msg)
+		}
+	}
+	code, msg := claim(fmt.Sprintf("0x%040x", 3))
+	if code != http.StatusTooManyRequests || !strings.HasPrefix(msg, "The faucet's daily budget is exhausted, it resets in ") {
+		t.Errorf("Expected the daily budget to be exhausted, got %d: %s", code, msg)
+	}
+
+	// The refused claim is not counted against the hourly budget
+	rr := httptest.NewRecorder()
+	server.handleInfo(n).ServeHTTP(rr, httptest.NewRequest("GET", "/api/info", nil))
+	var info infoResponse
+	json.Unmarshal(rr.Body.Bytes(), &info)
+	if info.Budget == nil || info.Budget.Hourly.Remaining != "1" || info.Budget.Daily.Remaining != "0" {
+		t.Errorf("Unexpected remaining budget %s", rr.Body.String())
+	}
+
+	// A claim that fails once dispatched is refunded to the budgets
+	n.settle(&chain.ClaimStatus{ID: claimID, State: chain.ClaimFailed})
+	rr = httptest.NewRecorder()
+	server.handleInfo(n).ServeHTTP(rr, httptest.NewRequest("GET", "/api/info", nil))
+	info = infoResponse{}
+	json.Unmarshal(rr.Body.Bytes(), &info)
+	if info.Budget == nil || info.Budget.Hourly.Remaining != "2" || info.Budget.Daily.Remaining != "1" {
+		t.Errorf("Unexpected remaining budget after a failed claim %s", rr.Body.String())
+	}
+}
+
+func TestHandleClaimStatus(t *testing.T) {
+	minedHash := common.HexToHash("0x5e1b2c8c4dbf2bfdcdbe2ec0d06e04b5b5e6a5e1b2c8c4dbf2bfdcdbe2ec0d06")
+	mockBuilder := new(MockTxBuilder)
+	revertedHash := common.Hash{2}
+	mockBuilder.On("Status", minedHash).Return(&chain.TxStatus{Hash: minedHash, State: chain.TxMined, BlockNumber: 42, Confirmations: 3}, true)
+	mockBuilder.On("Status", revertedHash).Return(&chain.TxStatus{Hash: revertedHash, State: chain.TxFailed, Reason: "execution reverted"}, true)
+	mockBuilder.On("Status", mock.Anything).Return(nil, false)
+
+	server := setupTestServer(mockBuilder)
+	claimID, _, err := server.networks[0].dispatcher.Enqueue(chain.ClaimRequest{To: "0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045", Value: big.NewInt(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		path     string
+		wantCode int
+	}{
+		{name: "mined", path: "/api/claim/" + minedHash.Hex(), wantCode: http.StatusOK},
+		{name: "queued", path: "/api/claim/" + claimID, wantCode: http.StatusOK},
+		{name: "unknown", path: "/api/claim/" + common.Hash{1}.Hex(), wantCode: http.StatusNotFound},
+		{name: "unknown claim", path: "/api/claim/0x1234", wantCode: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			handler := server.handleClaimStatus(server.networks[0])
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantCode {
+				t.Errorf("Expected status %d, but got %d", tt.wantCode, rr.Code)
+			}
+		})
+	}
+
+	req, _ := http.NewRequest("GET", "/api/claim/"+minedHash.Hex(), nil)
+	rr := httptest.NewRecorder()
+	server.handleClaimStatus(server.networks[0]).ServeHTTP(rr, req)
+	var resp claimStatusResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != "mined" || resp.BlockNumber != 42 || resp.Confirmations != 3 || resp.Code != "" {
+		t.Errorf("Unexpected claim status %+v", resp)
+	}
+
+	req, _ = http.NewRequest("GET", "/api/claim/"+revertedHash.Hex(), nil)
+	rr = httptest.NewRecorder()
+	server.handleClaimStatus(server.networks[0]).ServeHTTP(rr, req)
+	resp = claimStatusResponse{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != "failed" || resp.Code != codeTxFailed || resp.Reason != "execution reverted" {
+		t.Errorf("Unexpected failed claim status %+v", resp)
+	}
+
+	req, _ = http.NewRequest("GET", "/api/claim/"+claimID, nil)
+	rr = httptest.NewRecorder()
+	server.handleClaimStatus(server.networks[0]).ServeHTTP(rr, req)
+	resp = claimStatusResponse{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != "queued" || resp.Position != 1 {
+		t.Errorf("Unexpected queued claim status %+v", resp)
+	}
+}
+
+func TestStreamClaim(t *testing.T) {
+	sentHash, minedHash := common.Hash{1}, common.Hash{2}
+	mockBuilder := new(MockTxBuilder)
+	mockBuilder.On("Transfer", mock.Anything, mock.Anything, mock.Anything).Return(sentHash, nil)
+	mockBuilder.On("Status", sentHash).Return(&chain.TxStatus{Hash: minedHash, State: chain.TxMined, BlockNumber: 42}, true)
+
+	server := setupTestServer(mockBuilder)
+	claimID, _, err := server.networks[0].dispatcher.Enqueue(chain.ClaimRequest{To: "0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045", Value: big.NewInt(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go server.networks[0].dispatcher.Run(ctx)
+
+	rr := httptest.NewRecorder()
+	server.handleClaimStatus(server.networks[0]).ServeHTTP(rr, httptest.NewRequest("GET", "/api/claim/"+claimID+"/events", nil))
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Expected an event stream, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var events []string
+	for _, line := range strings.Split(rr.Body.String(), "\n") {
+		if strings.HasPrefix(line, "event: ") {
+			events = append(events, strings.TrimPrefix(line, "event: "))
+		}
+	}
+	if len(events) == 0 || events[len(events)-1] != "mined" {
+		t.Errorf("Expected the stream to end with the claim mined, got %v", events)
+	}
+	if !strings.Contains(rr.Body.String(), `"tx_hash":"`+minedHash.Hex()+`","block_number":42`) {
+		t.Errorf("Expected the mined transaction to be reported, got %s", rr.Body.String())
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		lastID   string
+		wantCode int
+	}{
+		{name: "finished", path: "/api/claim/" + claimID + "/events", lastID: "mined:0:" + minedHash.Hex() + ":42", wantCode: http.StatusNoContent},
+		{name: "unknown", path: "/api/claim/0x1234/events", wantCode: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			req.Header.Set("Last-Event-ID", tt.lastID)
+			rr := httptest.NewRecorder()
+			server.handleClaimStatus(server.networks[0]).ServeHTTP(rr, req)
+			if rr.Code != tt.wantCode {
+				t.Errorf("Expected status %d, but got %d", tt.wantCode, rr.Code)
+			}
+		})
+	}
 }
 
 func TestHandleInfo(t *testing.T) {
 	mockBuilder := new(MockTxBuilder)
 	mockBuilder.On("Sender").Return(common.HexToAddress("0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045"))
+	mockBuilder.On("TokenBalance", mock.Anything, mock.Anything).Return(big.NewInt(2500000), nil)
 
 	server := setupTestServer(mockBuilder)
 	req, err := http.NewRequest("GET", "/api/info", nil)
@@ -82,7 +545,7 @@ func TestHandleInfo(t *testing.T) {
 	}
 
 	rr := httptest.NewRecorder()
-	handler := server.handleInfo()
+	handler := server.handleInfo(server.networks[0])
 	handler.ServeHTTP(rr, req)
 
 	if rr.Code != http.StatusOK {
@@ -94,6 +557,446 @@ func TestHandleInfo(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
+	if len(resp.Tokens) != 1 || resp.Tokens[0].Balance != "2.5" {
+		t.Errorf("Unexpected token info %+v", resp.Tokens)
+	}
 
 	mockBuilder.AssertExpectations(t)
 }
+
+func TestMetrics(t *testing.T) {
+	server := setupTestServer(new(MockTxBuilder))
+	router := server.setupRouter()
+
+	req, err := http.NewRequest("POST", "/api/claim", strings.NewReader(`{"address": "0x1234"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(negroni.NewResponseWriter(httptest.NewRecorder()), req)
+
+	req, err = http.NewRequest("GET", "/metrics", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, but got %d", http.StatusOK, rr.Code)
+	}
+	for _, want := range []string{
+		`faucet_claims_rejected_total{reason="malformed"}`,
+		"faucet_limiter_records 0",
+		`faucet_queue_depth{network="testnet"} 0`,
+	} {
+		if !strings.Contains(rr.Body.String(), want) {
+			t.Errorf("Expected metrics to contain %s", want)
+		}
+	}
+}
+
+func TestReload(t *testing.T) {
+	mockBuilder := new(MockTxBuilder)
+	mockBuilder.On("Sender").Return(common.HexToAddress("0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045"))
+
+	server := setupTestServer(mockBuilder)
+	n := server.networks[0]
+	old := n.current()
+	if err := server.allowlist.Add("10.0.0.0/8"); err != nil {
+		t.Fatal(err)
+	}
+	apiKey, _, err := server.apiKeys.Issue("ci", 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Reload(&Config{
+		captcha: config.CaptchaConfig{Provider: "hcaptcha", SiteKey: "sitekey", Secret: "secret"},
+		networks: []NetworkConfig{{
+			network:  "testnet",
+			symbol:   "ETH",
+			payout:   0.25,
+			interval: 60,
+		}},
+	})
+
+	if old.payoutWei.Cmp(chain.EtherToWei(1)) != 0 {
+		t.Error("Expected settings taken before the reload to be left untouched")
+	}
+	if st := n.current(); st.payoutWei.Cmp(chain.EtherToWei(0.25)) != 0 || server.current().captcha == nil {
+		t.Errorf("Expected reloaded payout and captcha, got %v", st.payoutWei)
+	}
+	if ttl := time.Duration(n.limiter.ttl); ttl != time.Hour {
+		t.Errorf("Expected limiter TTL of 1h, got %v", ttl)
+	}
+	if !server.allowlist.Contains("", "10.1.2.3") {
+		t.Error("Expected the allowlist entry added through the admin API to survive the reload")
+	}
+	if _, ok := server.apiKeys.Lookup(apiKey); !ok {
+		t.Error("Expected the API key issued through the admin API to survive the reload")
+	}
+
+	req, err := http.NewRequest("GET", "/api/info", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	server.handleInfo(server.networks[0]).ServeHTTP(rr, req)
+	var resp infoResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Payout != "0.25" || resp.HcaptchaSiteKey != "sitekey" || resp.CaptchaProvider != "hcaptcha" || len(resp.Tokens) != 0 {
+		t.Errorf("Unexpected info after reload %+v", resp)
+	}
+}
+
+func TestMultipleNetworks(t *testing.T) {
+	address := "0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045"
+	sepolia, holesky := new(MockTxBuilder), new(MockTxBuilder)
+	sepolia.On("Sender").Return(common.HexToAddress("0x1c7D4B196Cb0C7B01d743Fbc6116a902379C7238"))
+	holesky.On("Sender").Return(common.HexToAddress("0x5FbDB2315678afecb367f032d93F642f64180aa3"))
+	cfg := &Config{networks: []NetworkConfig{
+		{network: "Sepolia", symbol: "ETH", payout: 1, interval: 60},
+		{network: "Holesky", symbol: "HETH", payout: 2, interval: 60},
+	}}
+	server := NewServer(map[string]chain.TxBuilder{"Sepolia": sepolia, "Holesky": holesky}, nil, NewMemoryStore(), nil, cfg)
+	router := server.setupRouter()
+
+	info := func(path string) infoResponse {
+		req, _ := http.NewRequest("GET", path, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status %d for %s, but got %d", http.StatusOK, path, rr.Code)
+		}
+		var resp infoResponse
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		return resp
+	}
+	if resp := info("/api/info"); resp.Network != "Sepolia" || len(resp.Networks) != 2 || resp.Networks[1].ID != "holesky" {
+		t.Errorf("Expected the first network by default with a list of networks, got %+v", resp)
+	}
+	if resp := info("/api/holesky/info"); resp.Symbol != "HETH" || resp.Payout != "2" || resp.Account != "0x5FbDB2315678afecb367f032d93F642f64180aa3" {
+		t.Errorf("Unexpected info of the second network %+v", resp)
+	}
+
+	// Each network has its own rate limit
+	claims := []struct {
+		path string
+		code int
+	}{
+		{"/api/sepolia/claim", http.StatusOK},
+		{"/api/holesky/claim", http.StatusOK},
+		{"/api/holesky/claim", http.StatusTooManyRequests},
+	}
+	for _, claim := range claims {
+		req, _ := http.NewRequest("POST", claim.path, strings.NewReader(`{"address": "`+address+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != claim.code {
+			t.Errorf("Expected status %d for %s, but got %d", claim.code, claim.path, rr.Code)
+		}
+	}
+	if depths := []int{server.networks[0].dispatcher.Depth(), server.networks[1].dispatcher.Depth()}; depths[0] != 1 || depths[1] != 1 {
+		t.Errorf("Expected one queued claim per network, got %v", depths)
+	}
+}
+
+func TestAdmin(t *testing.T) {
+	address := "0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045"
+	mockBuilder := new(MockTxBuilder)
+	mockBuilder.On("RefreshNonce", mock.Anything).Return(nil)
+	server := setupTestServer(mockBuilder)
+	server.networks[0].limiter.SetTTL(time.Hour)
+	server.current().cfg.admin = config.AdminConfig{Token: "secret", User: "ops", Password: "hunter2"}
+	router := server.setupRouter()
+
+	do := func(method, path, body string, auth func(*http.Request)) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if auth != nil {
+			auth(req)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+	bearer := func(req *http.Request) { req.Header.Set("Authorization", "Bearer secret") }
+	claim := func() int {
+		return do("POST", "/api/claim", `{"address": "`+address+`"}`, nil).Code
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		auth   func(*http.Request)
+		code   int
+	}{
+		{"no credentials", "POST", "/admin/pause", "", nil, http.StatusUnauthorized},
+		{"wrong token", "POST", "/admin/pause", "", func(req *http.Request) { req.Header.Set("Authorization", "Bearer guess") }, http.StatusUnauthorized},
+		{"wrong password", "POST", "/admin/pause", "", func(req *http.Request) { req.SetBasicAuth("ops", "guess") }, http.StatusUnauthorized},
+		{"basic auth", "POST", "/admin/resume", "", func(req *http.Request) { req.SetBasicAuth("ops", "hunter2") }, http.StatusOK},
+		{"unknown network", "POST", "/admin/pause?network=mainnet", "", bearer, http.StatusNotFound},
+		{"invalid payout", "PUT", "/admin/payout", `{"amount": 0}`, bearer, http.StatusBadRequest},
+		{"invalid limit key", "DELETE", "/admin/limits/nobody", "", bearer, http.StatusBadRequest},
+		{"nonce", "POST", "/admin/nonce", "", bearer, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rr := do(tt.method, tt.path, tt.body, tt.auth); rr.Code != tt.code {
+				t.Errorf("Expected status %d, but got %d: %s", tt.code, rr.Code, rr.Body.String())
+			}
+		})
+	}
+	mockBuilder.AssertCalled(t, "RefreshNonce", mock.Anything)
+
+	do("POST", "/admin/pause", "", bearer)
+	if code := claim(); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected claims to be refused while paused, got %d", code)
+	}
+	do("POST", "/admin/resume", "", bearer)
+	if code := claim(); code != http.StatusOK {
+		t.Errorf("Expected claims to be accepted after resuming, got %d", code)
+	}
+	if code := claim(); code != http.StatusTooManyRequests {
+		t.Errorf("Expected the second claim to be rate limited, got %d", code)
+	}
+	if rr := do("DELETE", "/admin/limits/"+strings.ToLower(address), "", bearer); rr.Code != http.StatusOK {
+		t.Fatalf("Failed to clear the rate limit: %s", rr.Body.String())
+	}
+	if rr := do("DELETE", "/admin/limits/192.0.2.1", "", bearer); rr.Code != http.StatusOK {
+		t.Fatalf("Failed to clear the rate limit: %s", rr.Body.String())
+	}
+	if code := claim(); code != http.StatusOK {
+		t.Errorf("Expected a claim to be accepted after clearing the rate limit, got %d", code)
+	}
+
+	do("PUT", "/admin/payout", `{"amount": 0.25}`, bearer)
+	if payout := server.networks[0].current().payoutWei; payout.Cmp(chain.EtherToWei(0.25)) != 0 {
+		t.Errorf("Expected the payout to be changed, got %s", payout)
+	}
+
+	rr := do("GET", "/admin/claims?limit=10", "", bearer)
+	var claims []adminClaim
+	json.Unmarshal(rr.Body.Bytes(), &claims)
+	if len(claims) != 2 || claims[0].Address != address || claims[0].Amount != "1" || claims[0].Status != string(chain.ClaimQueued) {
+		t.Errorf("Unexpected recent claims %s", rr.Body.String())
+	}
+}
+
+func TestTiers(t *testing.T) {
+	cfg := &Config{
+		github: config.GitHubConfig{ClientID: "client", ClientSecret: "secret"},
+		networks: []NetworkConfig{{network: "testnet", symbol: "ETH", payout: 1, interval: 60, tiers: []Tier{
+			{Name: "ci", Identity: "apikey", Payout: 5},
+			{Name: "contributors", Identity: "github", Payout: 2, Interval: 60},
+		}}},
+	}
+	server := NewServer(map[string]chain.TxBuilder{"testnet": new(MockTxBuilder)}, nil, NewMemoryStore(), nil, cfg)
+	router := server.setupRouter()
+	ciKey, _, err := server.apiKeys.Issue("ci", 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := "octocat." + strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+	session := &http.Cookie{Name: sessionCookie, Value: payload + "." + server.current().github.sign(payload)}
+
+	tests := []struct {
+		name     string
+		address  string
+		apiKey   string
+		session  bool
+		code     int
+		wantTier string
+		wantWei  *big.Int
+	}{
+		{name: "anonymous", address: "0x0000000000000000000000000000000000000001", code: http.StatusOK, wantTier: "anonymous", wantWei: chain.EtherToWei(1)},
+		{name: "api key", address: "0x0000000000000000000000000000000000000002", apiKey: ciKey, code: http.StatusOK, wantTier: "ci", wantWei: chain.EtherToWei(5)},
+		{name: "api key cooldown", address: "0x0000000000000000000000000000000000000002", apiKey: ciKey, code: http.StatusTooManyRequests},
+		{name: "unknown api key", address: "0x0000000000000000000000000000000000000003", apiKey: "guess", code: http.StatusUnauthorized},
+		{name: "github", address: "0x0000000000000000000000000000000000000004", session: true, code: http.StatusOK, wantTier: "contributors", wantWei: chain.EtherToWei(2)},
+		{name: "github cooldown", address: "0x0000000000000000000000000000000000000004", session: true, code: http.StatusTooManyRequests},
+		{name: "github cooldown from another address", address: "0x0000000000000000000000000000000000000005", session: true, code: http.StatusTooManyRequests},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/api/claim", strings.NewReader(`{"address": "`+tt.address+`"}`))
+			req.RemoteAddr = fmt.Sprintf("192.0.2.%d:1234", i+1)
+			if tt.apiKey != "" {
+				req.Header.Set("X-Api-Key", tt.apiKey)
+			}
+			if tt.session {
+				req.AddCookie(session)
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			if rr.Code != tt.code {
+				t.Fatalf("Expected status %d, but got %d: %s", tt.code, rr.Code, rr.Body.String())
+			}
+			if rr.Code != http.StatusOK {
+				return
+			}
+			var resp claimResponse
+			json.Unmarshal(rr.Body.Bytes(), &resp)
+			status, _ := server.networks[0].dispatcher.Status(resp.ClaimID)
+			if resp.Tier != tt.wantTier || status.Request.Value.Cmp(tt.wantWei) != 0 {
+				t.Errorf("Expected tier %s paying %v, got %s paying %v", tt.wantTier, tt.wantWei, resp.Tier, status.Request.Value)
+			}
+		})
+	}
+}
+
+func TestAPIKeyClaims(t *testing.T) {
+	cfg := &Config{
+		powDifficulty: 20,
+		powSecret:     "secret",
+		powTTL:        time.Minute,
+		networks:      []NetworkConfig{{network: "testnet", symbol: "ETH", payout: 1, interval: 60}},
+	}
+	server := NewServer(map[string]chain.TxBuilder{"testnet": new(MockTxBuilder)}, nil, NewMemoryStore(), nil, cfg)
+	router := server.setupRouter()
+	budgeted, key, err := server.apiKeys.Issue("budgeted", 0, 0.5, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	limited, _, err := server.apiKeys.Issue("limited", 1, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		apiKey  string
+		code    int
+		wantWei *big.Int
+	}{
+		{name: "without key or proof of work", code: http.StatusForbidden},
+		{name: "capped payout", apiKey: budgeted, code: http.StatusOK, wantWei: chain.EtherToWei(0.5)},
+		{name: "within budget", apiKey: budgeted, code: http.StatusOK, wantWei: chain.EtherToWei(0.5)},
+		{name: "budget exhausted", apiKey: budgeted, code: http.StatusTooManyRequests},
+		{name: "within rate limit", apiKey: limited, code: http.StatusOK, wantWei: chain.EtherToWei(1)},
+		{name: "rate limited", apiKey: limited, code: http.StatusTooManyRequests},
+	}
+	claimIDs := make(map[string][]string)
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Keyed claims share an IP, as scripts do, but not an address
+			address := fmt.Sprintf("0x%040x", i+1)
+			req := httptest.NewRequest("POST", "/api/claim", strings.NewReader(`{"address": "`+address+`"}`))
+			req.RemoteAddr = "192.0.2.1:1234"
+			if tt.apiKey != "" {
+				req.Header.Set("X-Api-Key", tt.apiKey)
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			if rr.Code != tt.code {
+				t.Fatalf("Expected status %d, but got %d: %s", tt.code, rr.Code, rr.Body.String())
+			}
+			if rr.Code != http.StatusOK {
+				return
+			}
+			var resp claimResponse
+			json.Unmarshal(rr.Body.Bytes(), &resp)
+			status, _ := server.networks[0].dispatcher.Status(resp.ClaimID)
+			if status.Request.Value.Cmp(tt.wantWei) != 0 {
+				t.Errorf("Expected payout of %v, got %v", tt.wantWei, status.Request.Value)
+			}
+			claimIDs[tt.apiKey] = append(claimIDs[tt.apiKey], resp.ClaimID)
+		})
+	}
+
+	claims, paid, today, err := usageOf(context.Background(), server.networks[0].store, &key)
+	if err != nil || claims != 2 || gweiToEther(paid) != "1" || gweiToEther(today) != "1" {
+		t.Errorf("usageOf() = %d, %d, %d, %v", claims, paid, today, err)
+	}
+
+	// Claims that fail once dispatched are refunded to their key
+	for _, id := range []string{claimIDs[budgeted][0], claimIDs[limited][0]} {
+		server.networks[0].settle(&chain.ClaimStatus{ID: id, State: chain.ClaimFailed})
+	}
+	claims, paid, today, err = usageOf(context.Background(), server.networks[0].store, &key)
+	if err != nil || claims != 1 || gweiToEther(paid) != "0.5" || gweiToEther(today) != "0.5" {
+		t.Errorf("usageOf() after failed claim = %d, %d, %d, %v", claims, paid, today, err)
+	}
+	req := httptest.NewRequest("POST", "/api/claim", strings.NewReader(`{"address": "0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045"}`))
+	req.Header.Set("X-Api-Key", limited)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected the failed claim not to count against the rate limit, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestLimiterAccessLists(t *testing.T) {
+	allow, deny := NewAccessList(), NewAccessList()
+	allow.Add("203.0.113.0/24")
+	deny.Add("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B")
+	limiter := NewLimiter(NewMemoryStore(), 0, time.Hour, allow, deny)
+	handler := negroni.New(limiter, negroni.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		renderJSON(w, claimResponse{Message: "ok"}, http.StatusOK)
+	})))
+
+	tests := []struct {
+		name     string
+		address  string
+		clientIP string
+		code     int
+	}{
+		{"denied address", "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", "203.0.113.7", http.StatusForbidden},
+		{"allowed IP", "0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045", "203.0.113.7", http.StatusOK},
+		{"allowed IP again", "0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045", "203.0.113.7", http.StatusOK},
+		{"other IP", "0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045", "192.0.2.1", http.StatusOK},
+		{"other IP again", "0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045", "192.0.2.1", http.StatusTooManyRequests},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/api/claim", strings.NewReader(`{"address": "`+tt.address+`"}`))
+			req.RemoteAddr = tt.clientIP + ":1234"
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			if rr.Code != tt.code {
+				t.Errorf("Expected status %d, but got %d: %s", tt.code, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestClaimResponseCodes(t *testing.T) {
+	cfg := &Config{networks: []NetworkConfig{{network: "testnet", symbol: "ETH", payout: 1, interval: 60}}}
+	server := NewServer(map[string]chain.TxBuilder{"testnet": new(MockTxBuilder)}, nil, NewMemoryStore(), nil, cfg)
+	router := server.setupRouter()
+
+	tests := []struct {
+		name           string
+		body           string
+		wantStatus     int
+		wantCode       string
+		wantRetryAfter bool
+	}{
+		{"malformed", `{"address": `, http.StatusBadRequest, codeInvalidRequest, false},
+		{"invalid address", `{"address": "0x1234"}`, http.StatusBadRequest, codeInvalidAddress, false},
+		{"unsupported token", `{"address": "0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045", "token": "DOGE"}`, http.StatusBadRequest, codeUnsupportedToken, false},
+		{"queued", `{"address": "0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045"}`, http.StatusOK, codeQueued, false},
+		{"rate limited", `{"address": "0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045"}`, http.StatusTooManyRequests, codeRateLimited, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest("POST", "/api/claim", strings.NewReader(tt.body)))
+			var resp claimResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if rr.Code != tt.wantStatus || resp.Code != tt.wantCode || resp.Version != claimAPIVersion || resp.Message == "" {
+				t.Errorf("Expected status %d with code %s, got %d: %s", tt.wantStatus, tt.wantCode, rr.Code, rr.Body.String())
+			}
+			if tt.wantRetryAfter && (resp.RetryAfter != 3600 || rr.Header().Get("Retry-After") != "3600") {
+				t.Errorf("Expected to retry after an hour, got %d and header %q", resp.RetryAfter, rr.Header().Get("Retry-After"))
+			}
+		})
+	}
+}
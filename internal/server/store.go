@@ -0,0 +1,348 @@
+package server
+
+import (
+	"context"
+	"encoding/binary"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jellydator/ttlcache/v2"
+	log "github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+)
+
+// LimitStore keeps the rate limit records of the Limiter. Implementations
+// must be safe for concurrent use, including across processes when several
+// faucet replicas share one store.
+type LimitStore interface {
+	// Reserve atomically checks that none of the keys is limited and records
+	// all of them for ttl. If any key is already limited nothing is recorded,
+	// and the remaining time-to-live of that key is returned with false.
+	Reserve(ctx context.Context, keys []string, ttl time.Duration) (time.Duration, bool, error)
+	Remove(ctx context.Context, keys ...string) error
+	// Add atomically increases the counter at key by delta and returns its
+	// new value. A new counter expires after ttl, or never if ttl is zero.
+	Add(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error)
+	// Get returns the value of the counter at key, or zero if there is none
+	Get(ctx context.Context, key string) (int64, error)
+	// Len returns the number of cooldown records held by the store, leaving
+	// out counters and used proof-of-work challenges
+	Len(ctx context.Context) (int, error)
+	Close() error
+}
+
+type MemoryStore struct {
+	mutex sync.Mutex
+	cache *ttlcache.Cache
+}
+
+func NewMemoryStore() *MemoryStore {
+	cache := ttlcache.NewCache()
+	cache.SkipTTLExtensionOnHit(true)
+	return &MemoryStore{cache: cache}
+}
+
+func (s *MemoryStore) Reserve(_ context.Context, keys []string, ttl time.Duration) (time.Duration, bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, key := range keys {
+		if _, remaining, err := s.cache.GetWithTTL(key); err == nil {
+			return remaining, false, nil
+		}
+	}
+	for _, key := range keys {
+		if err := s.cache.SetWithTTL(key, true, ttl); err != nil {
+			return 0, false, err
+		}
+	}
+	return 0, true, nil
+}
+
+func (s *MemoryStore) Remove(_ context.Context, keys ...string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, key := range keys {
+		if err := s.cache.Remove(key); err != nil && err != ttlcache.ErrNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+// memoryCounter is updated in place, so that adding to it leaves its
+// expiry untouched.
+type memoryCounter struct {
+	value int64
+}
+
+func (s *MemoryStore) Add(_ context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if value, err := s.cache.Get(key); err == nil {
+		if counter, ok := value.(*memoryCounter); ok {
+			counter.value += delta
+			return counter.value, nil
+		}
+	}
+	if err := s.cache.SetWithTTL(key, &memoryCounter{value: delta}, ttl); err != nil {
+		return 0, err
+	}
+	return delta, nil
+}
+
+func (s *MemoryStore) Get(_ context.Context, key string) (int64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if value, err := s.cache.Get(key); err == nil {
+		if counter, ok := value.(*memoryCounter); ok {
+			return counter.value, nil
+		}
+	}
+	return 0, nil
+}
+
+func (s *MemoryStore) Len(_ context.Context) (int, error) {
+	var n int
+	for _, key := range s.cache.GetKeys() {
+		if isCooldownKey(key) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *MemoryStore) Close() error {
+	return s.cache.Close()
+}
+
+// otherKeyFamilies prefix the keys kept in the limit store next to the
+// cooldown records: API key and budget counters, and used proof-of-work
+// challenges.
+var otherKeyFamilies = []string{"apikey", "budget", "pow"}
+
+// isCooldownKey reports whether key is a cooldown record rather than one of
+// otherKeyFamilies, which may follow the network prefix of a prefixStore.
+func isCooldownKey(key string) bool {
+	parts := strings.SplitN(key, ":", 3)
+	if len(parts) > 2 {
+		parts = parts[:2]
+	}
+	for _, part := range parts {
+		for _, family := range otherKeyFamilies {
+			if part == family {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// prefixStore namespaces the keys of a shared store, so that networks
+// sharing it keep separate rate limits.
+type prefixStore struct {
+	LimitStore
+	prefix string
+}
+
+func newPrefixStore(store LimitStore, prefix string) *prefixStore {
+	return &prefixStore{LimitStore: store, prefix: prefix}
+}
+
+func (s *prefixStore) Reserve(ctx context.Context, keys []string, ttl time.Duration) (time.Duration, bool, error) {
+	return s.LimitStore.Reserve(ctx, s.prefixed(keys), ttl)
+}
+
+func (s *prefixStore) Remove(ctx context.Context, keys ...string) error {
+	return s.LimitStore.Remove(ctx, s.prefixed(keys)...)
+}
+
+func (s *prefixStore) Add(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	return s.LimitStore.Add(ctx, s.prefix+key, delta, ttl)
+}
+
+func (s *prefixStore) Get(ctx context.Context, key string) (int64, error) {
+	return s.LimitStore.Get(ctx, s.prefix+key)
+}
+
+func (s *prefixStore) prefixed(keys []string) []string {
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = s.prefix + key
+	}
+	return prefixed
+}
+
+var limitsBucket = []byte("limits")
+
+// BoltStore persists rate limit records in a BoltDB file so that they
+// survive restarts of the faucet.
+type BoltStore struct {
+	db   *bolt.DB
+	done chan struct{}
+}
+
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(limitsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	s := &BoltStore{db: db, done: make(chan struct{})}
+	go s.purgeLoop(time.Minute)
+	return s, nil
+}
+
+func (s *BoltStore) Reserve(_ context.Context, keys []string, ttl time.Duration) (time.Duration, bool, error) {
+	var remaining time.Duration
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(limitsBucket)
+		for _, key := range keys {
+			if value := bucket.Get([]byte(key)); len(value) == 8 {
+				if remaining = time.Until(decodeExpiry(value)); remaining > 0 {
+					return nil
+				}
+			}
+		}
+		expiry := encodeExpiry(time.Now().Add(ttl))
+		for _, key := range keys {
+			if err := bucket.Put([]byte(key), expiry); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, false, err
+	}
+	if remaining > 0 {
+		return remaining, false, nil
+	}
+	return 0, true, nil
+}
+
+func (s *BoltStore) Remove(_ context.Context, keys ...string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(limitsBucket)
+		for _, key := range keys {
+			if err := bucket.Delete([]byte(key)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Add keeps counters next to the rate limit records, as the expiry followed
+// by the value. A zero expiry never expires.
+func (s *BoltStore) Add(_ context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	var total int64
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(limitsBucket)
+		value := make([]byte, 16)
+		if old := bucket.Get([]byte(key)); len(old) == 16 && !isExpired(old, time.Now()) {
+			copy(value, old[:8])
+			total = int64(binary.BigEndian.Uint64(old[8:]))
+		} else if ttl > 0 {
+			copy(value, encodeExpiry(time.Now().Add(ttl)))
+		}
+		total += delta
+		binary.BigEndian.PutUint64(value[8:], uint64(total))
+		return bucket.Put([]byte(key), value)
+	})
+	return total, err
+}
+
+func (s *BoltStore) Get(_ context.Context, key string) (int64, error) {
+	var total int64
+	err := s.db.View(func(tx *bolt.Tx) error {
+		if value := tx.Bucket(limitsBucket).Get([]byte(key)); len(value) == 16 && !isExpired(value, time.Now()) {
+			total = int64(binary.BigEndian.Uint64(value[8:]))
+		}
+		return nil
+	})
+	return total, err
+}
+
+// Len also counts expired records that have not been purged yet.
+func (s *BoltStore) Len(_ context.Context) (int, error) {
+	var n int
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(limitsBucket).ForEach(func(k, _ []byte) error {
+			if isCooldownKey(string(k)) {
+				n++
+			}
+			return nil
+		})
+	})
+	return n, err
+}
+
+func (s *BoltStore) Close() error {
+	close(s.done)
+	return s.db.Close()
+}
+
+func (s *BoltStore) purgeLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			if err := s.purgeExpired(); err != nil {
+				log.WithError(err).Warn("Failed to purge expired rate limit records")
+			}
+		}
+	}
+}
+
+func (s *BoltStore) purgeExpired() error {
+	now := time.Now()
+	return s.db.Update(func(tx *bolt.Tx) error {
+		c := tx.Bucket(limitsBucket).Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			if isExpired(v, now) {
+				if err := c.Delete(); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// isExpired reports whether a rate limit record or counter has expired.
+func isExpired(value []byte, now time.Time) bool {
+	switch len(value) {
+	case 8:
+		return !decodeExpiry(value).After(now)
+	case 16:
+		return binary.BigEndian.Uint64(value) != 0 && !decodeExpiry(value[:8]).After(now)
+	default:
+		return true
+	}
+}
+
+func encodeExpiry(t time.Time) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(t.UnixNano()))
+	return buf
+}
+
+func decodeExpiry(b []byte) time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(b)))
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// reserveScript checks and records all keys in one step, so replicas sharing
+// the same Redis server cannot both reserve a key. It returns the remaining
+// time-to-live in milliseconds of the first limited key, or 0 on success.
+var reserveScript = redis.NewScript(`
+for _, key in ipairs(KEYS) do
+	local ttl = redis.call("PTTL", key)
+	if ttl > 0 then
+		return ttl
+	end
+end
+for _, key in ipairs(KEYS) do
+	redis.call("SET", key, 1, "PX", ARGV[1])
+end
+return 0
+`)
+
+// addScript increments a counter and sets its expiry when it is created.
+var addScript = redis.NewScript(`
+local total = redis.call("INCRBY", KEYS[1], ARGV[1])
+if tonumber(ARGV[2]) > 0 and redis.call("PTTL", KEYS[1]) == -1 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return total
+`)
+
+// RedisStore keeps rate limit records in a Redis-compatible server so that
+// they are shared by all faucet replicas.
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedisStore(url, prefix string) (*RedisStore, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+
+	client := redis.NewClient(opts)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return &RedisStore{client: client, prefix: prefix}, nil
+}
+
+func (s *RedisStore) Reserve(ctx context.Context, keys []string, ttl time.Duration) (time.Duration, bool, error) {
+	remaining, err := reserveScript.Run(ctx, s.client, s.prefixed(keys), ttl.Milliseconds()).Int64()
+	if err != nil {
+		return 0, false, err
+	}
+	if remaining > 0 {
+		return time.Duration(remaining) * time.Millisecond, false, nil
+	}
+	return 0, true, nil
+}
+
+func (s *RedisStore) Remove(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	return s.client.Del(ctx, s.prefixed(keys)...).Err()
+}
+
+func (s *RedisStore) Add(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	return addScript.Run(ctx, s.client, []string{s.prefix + key}, delta, ttl.Milliseconds()).Int64()
+}
+
+func (s *RedisStore) Get(ctx context.Context, key string) (int64, error) {
+	total, err := s.client.Get(ctx, s.prefix+key).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return total, err
+}
+
+func (s *RedisStore) Len(ctx context.Context) (int, error) {
+	var n int
+	iter := s.client.Scan(ctx, 0, s.prefix+"*", 1000).Iterator()
+	for iter.Next(ctx) {
+		if isCooldownKey(strings.TrimPrefix(iter.Val(), s.prefix)) {
+			n++
+		}
+	}
+	return n, iter.Err()
+}
+
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
+
+func (s *RedisStore) prefixed(keys []string) []string {
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = s.prefix + key
+	}
+	return prefixed
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestLimitStore(t *testing.T) {
+	boltStore, err := NewBoltStore(filepath.Join(t.TempDir(), "limiter.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	redisServer := miniredis.RunT(t)
+	redisStore, err := NewRedisStore("redis://"+redisServer.Addr(), "test:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stores := map[string]LimitStore{
+		"memory": NewMemoryStore(),
+		"bolt":   boltStore,
+		"redis":  redisStore,
+	}
+	ctx := context.Background()
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			defer store.Close()
+
+			if _, ok, err := store.Reserve(ctx, []string{"0xabc", "127.0.0.1"}, time.Minute); err != nil || !ok {
+				t.Fatalf("Reserve() on empty store = %v, %v", ok, err)
+			}
+			remaining, ok, err := store.Reserve(ctx, []string{"0xdef", "127.0.0.1"}, time.Minute)
+			if err != nil || ok {
+				t.Fatalf("Reserve() of limited key = %v, %v", ok, err)
+			}
+			if remaining <= 0 || remaining > time.Minute {
+				t.Errorf("Reserve() remaining = %v, want within (0, 1m]", remaining)
+			}
+			// A rejected reservation must not record any of its keys
+			if _, ok, _ := store.Reserve(ctx, []string{"0xdef"}, time.Minute); !ok {
+				t.Error("Reserve() recorded keys of a rejected reservation")
+			}
+			if err := store.Remove(ctx, "0xabc", "127.0.0.1"); err != nil {
+				t.Fatal(err)
+			}
+			if _, ok, _ := store.Reserve(ctx, []string{"0xabc", "127.0.0.1"}, time.Minute); !ok {
+				t.Error("Reserve() after Remove() still limited")
+			}
+			if err := store.Remove(ctx, "0xmissing"); err != nil {
+				t.Errorf("Remove() of missing key = %v", err)
+			}
+			if n, err := store.Len(ctx); err != nil || n != 3 {
+				t.Errorf("Len() = %d, %v, want 3", n, err)
+			}
+
+			if total, err := store.Add(ctx, "budget:hour:2026-10-18T12", 5, time.Minute); err != nil || total != 5 {
+				t.Fatalf("Add() to new counter = %d, %v", total, err)
+			}
+			if total, err := store.Add(ctx, "budget:hour:2026-10-18T12", -2, time.Minute); err != nil || total != 3 {
+				t.Errorf("Add() to counter = %d, %v, want 3", total, err)
+			}
+			if total, err := store.Add(ctx, "sepolia:apikey:k1:claims", 1, 0); err != nil || total != 1 {
+				t.Errorf("Add() to counter without expiry = %d, %v", total, err)
+			}
+			if total, err := store.Get(ctx, "budget:hour:2026-10-18T12"); err != nil || total != 3 {
+				t.Errorf("Get() of counter = %d, %v, want 3", total, err)
+			}
+			// Reading a missing counter does not create it
+			if total, err := store.Get(ctx, "missing"); err != nil || total != 0 {
+				t.Errorf("Get() of missing counter = %d, %v", total, err)
+			}
+			if _, ok, err := store.Reserve(ctx, []string{"pow:salt"}, time.Minute); err != nil || !ok {
+				t.Fatalf("Reserve() of challenge = %v, %v", ok, err)
+			}
+			// Counters and used challenges are not cooldown records
+			if n, err := store.Len(ctx); err != nil || n != 3 {
+				t.Errorf("Len() = %d, %v, want 3", n, err)
+			}
+		})
+	}
+}
+
+func TestBoltStorePersistence(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "limiter.db")
+	store, err := NewBoltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Reserve(ctx, []string{"127.0.0.1"}, time.Hour)
+	store.Reserve(ctx, []string{"10.0.0.1"}, -time.Second)
+	store.Add(ctx, "claims", 2, 0)
+	store.Close()
+
+	store, err = NewBoltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	if _, ok, err := store.Reserve(ctx, []string{"127.0.0.1"}, time.Hour); err != nil || ok {
+		t.Errorf("record did not survive reopening: %v, %v", ok, err)
+	}
+	if err := store.purgeExpired(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := store.Reserve(ctx, []string{"10.0.0.1"}, time.Hour); !ok {
+		t.Error("expired record is still limited")
+	}
+	if total, _ := store.Add(ctx, "claims", 0, 0); total != 2 {
+		t.Errorf("counter without expiry = %d after purge, want 2", total)
+	}
+}
+
+func TestRedisStoreSharedAcrossReplicas(t *testing.T) {
+	ctx := context.Background()
+	redisServer := miniredis.RunT(t)
+	replicaA, err := NewRedisStore("redis://"+redisServer.Addr(), "faucet:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replicaA.Close()
+	replicaB, err := NewRedisStore("redis://"+redisServer.Addr(), "faucet:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replicaB.Close()
+
+	if _, ok, _ := replicaA.Reserve(ctx, []string{"0xabc"}, time.Hour); !ok {
+		t.Fatal("first replica could not reserve key")
+	}
+	if _, ok, _ := replicaB.Reserve(ctx, []string{"0xabc"}, time.Hour); ok {
+		t.Error("second replica reserved a key held by the first")
+	}
+
+	redisServer.FastForward(time.Hour)
+	if _, ok, _ := replicaB.Reserve(ctx, []string{"0xabc"}, time.Hour); !ok {
+		t.Error("key is still limited after its ttl elapsed")
+	}
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"context"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/chainflag/eth-faucet/internal/metrics"
+)
+
+// anonymousTier names the payout of claimants presenting no identity.
+const anonymousTier = "anonymous"
+
+// Tier is a payout level granted to claimants presenting an identity.
+type Tier struct {
+	Name string
+	// Identity is one of apikey, github or allowlist
+	Identity string
+	Payout   float64
+	// Interval is the cooldown in minutes, that of the network when 0
+	Interval int
+}
+
+// identity records what a claimant has proven about themselves.
+type identity struct {
+	// APIKey is the record of the API key presented
+	APIKey *APIKey
+	// GitHub is the login of the signed in GitHub account
+	GitHub      string
+	Allowlisted bool
+}
+
+func (id identity) has(kind string) bool {
+	switch kind {
+	case "apikey":
+		return id.APIKey != nil
+	case "github":
+		return id.GitHub != ""
+	case "allowlist":
+		return id.Allowlisted
+	default:
+		return false
+	}
+}
+
+// matchTier returns the first tier whose identity id presents, or nil if
+// the claim is anonymous.
+func matchTier(tiers []Tier, id identity) *Tier {
+	for i := range tiers {
+		if id.has(tiers[i].Identity) {
+			return &tiers[i]
+		}
+	}
+	return nil
+}
+
+func tierName(tier *Tier) string {
+	if tier == nil {
+		return anonymousTier
+	}
+	return tier.Name
+}
+
+// hasAPIKey reports whether the claim is made with a valid API key.
+func hasAPIKey(r *http.Request) bool {
+	id, _ := r.Context().Value(identityContextKey).(identity)
+	return id.APIKey != nil
+}
+
+// identify records the API key and GitHub account a claim is made with, for
+// the limiter to pick its tier by. Claims with an unknown API key are
+// refused rather than treated as anonymous, so scripts notice a wrong key.
+func (s *Server) identify(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	var id identity
+	if raw := r.Header.Get("X-Api-Key"); raw != "" {
+		key, ok := s.apiKeys.Lookup(raw)
+		if !ok {
+			log.Debug("Refusing claim with unknown API key")
+			rejectClaim(r, metrics.ReasonInvalidAPIKey)
+			renderClaim(w, claimResponse{Code: codeInvalidAPIKey, Message: "Invalid API key"}, http.StatusUnauthorized)
+			return
+		}
+		id.APIKey = key
+	}
+	if st := s.current(); st.github != nil {
+		id.GitHub, _ = st.github.User(r)
+	}
+
+	next(w, r.WithContext(context.WithValue(r.Context(), identityContextKey, id)))
+}
@@ -0,0 +1,72 @@
+// Adapters for the captcha widgets supported by the faucet. Each renders an
+// invisible widget whose execute() resolves to the response token to send
+// along with a claim.
+
+export function captchaScript(provider, sitekey, onload) {
+  switch (provider) {
+    case 'hcaptcha':
+      return `https://hcaptcha.com/1/api.js?onload=${onload}&render=explicit`;
+    case 'recaptcha':
+      return `https://www.google.com/recaptcha/api.js?onload=${onload}&render=explicit`;
+    case 'recaptcha-v3':
+      return `https://www.google.com/recaptcha/api.js?onload=${onload}&render=${sitekey}`;
+    case 'turnstile':
+      return `https://challenges.cloudflare.com/turnstile/v0/api.js?onload=${onload}&render=explicit`;
+    default:
+      return '';
+  }
+}
+
+export function renderCaptcha(provider, el, sitekey) {
+  switch (provider) {
+    case 'hcaptcha': {
+      const id = window.hcaptcha.render(el, { sitekey, size: 'invisible' });
+      return {
+        execute: async () =>
+          (await window.hcaptcha.execute(id, { async: true })).response,
+      };
+    }
+    case 'recaptcha':
+      return callbackWidget(window.grecaptcha, (callbacks) =>
+        window.grecaptcha.render(el, {
+          sitekey,
+          size: 'invisible',
+          ...callbacks,
+        }),
+      );
+    case 'recaptcha-v3':
+      // The score is only meaningful for the action the server expects
+      return {
+        execute: () => window.grecaptcha.execute(sitekey, { action: 'claim' }),
+      };
+    case 'turnstile':
+      return callbackWidget(window.turnstile, (callbacks) =>
+        window.turnstile.render(el, {
+          sitekey,
+          execution: 'execute',
+          appearance: 'interaction-only',
+          ...callbacks,
+        }),
+      );
+    default:
+      throw new Error(`Unsupported captcha provider ${provider}`);
+  }
+}
+
+// callbackWidget wraps widgets that hand out their token through callbacks.
+function callbackWidget(api, render) {
+  let pending = null;
+  const id = render({
+    callback: (token) => pending?.resolve(token),
+    'error-callback': () => pending?.reject(new Error('Captcha failed')),
+  });
+  return {
+    execute: () =>
+      new Promise((resolve, reject) => {
+        pending = { resolve, reject };
+        // Tokens are single use, so start over for every claim
+        api.reset(id);
+        api.execute(id);
+      }),
+  };
+}
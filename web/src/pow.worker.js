@@ -0,0 +1,24 @@
+// Finds a nonce for which the SHA-256 hash of "<challenge>:<nonce>" starts
+// with the requested number of zero bits.
+self.onmessage = async ({ data: { challenge, difficulty } }) => {
+  const encoder = new TextEncoder();
+  for (let nonce = 0; ; nonce++) {
+    const digest = await crypto.subtle.digest(
+      'SHA-256',
+      encoder.encode(`${challenge}:${nonce}`),
+    );
+    if (leadingZeroBits(new Uint8Array(digest)) >= difficulty) {
+      self.postMessage(String(nonce));
+      return;
+    }
+  }
+};
+
+function leadingZeroBits(bytes) {
+  let bits = 0;
+  for (const byte of bytes) {
+    if (byte !== 0) return bits + Math.clz32(byte) - 24;
+    bits += 8;
+  }
+  return bits;
+}